@@ -7,13 +7,16 @@ import (
 	"net/http"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/pathorcontents"
 	"github.com/hashicorp/terraform/terraform"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"golang.org/x/oauth2/jwt"
-	"google.golang.org/api/appengine/v1beta4"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/iamcredentials/v1"
 	"google.golang.org/api/storage/v1"
 )
 
@@ -21,62 +24,113 @@ import (
 // provider.
 type Config struct {
 	Credentials string
+	AccessToken string
 	Project     string
 	Region      string
 
+	// ImpersonateServiceAccount is the email of a service account whose
+	// short lived tokens are used in place of the base credentials, minted
+	// through the optional chain of delegates
+	ImpersonateServiceAccount          string
+	ImpersonateServiceAccountDelegates []string
+
+	// Scopes replaces defaultClientScopes when set
+	Scopes []string
+
+	// AppengineEndpoint and StorageEndpoint override the base URL of the
+	// Google APIs, e.g. to point at a local fake server in tests
+	AppengineEndpoint string
+	StorageEndpoint   string
+
+	// UserAgentSuffix is appended to the user agent of every API call so
+	// they can be picked out of the audit logs
+	UserAgentSuffix string
+
+	// BillingProject is sent as the quota project of every API call when
+	// UserProjectOverride is set, falling back to Project when empty
+	BillingProject      string
+	UserProjectOverride bool
+
+	// RequestsPerSecond caps the rate of API calls shared by every resource,
+	// letting RequestBurst calls through at once; zero means no limit
+	RequestsPerSecond float64
+	RequestBurst      int
+
 	clientStorage  *storage.Service
 	clientAppengine *appengine.Service
+
+	operationPoller *operationPoller
 }
 
-func (c *Config) loadAndValidate() error {
-	var account accountFile
-	clientScopes := []string{
-		"https://www.googleapis.com/auth/compute",
-		"https://www.googleapis.com/auth/cloud-platform",
-		"https://www.googleapis.com/auth/ndev.clouddns.readwrite",
-		"https://www.googleapis.com/auth/devstorage.full_control",
+var defaultClientScopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+}
+
+// scopes returns the scopes to request for the base credentials and for the
+// token the API clients end up using.  When impersonating, the base
+// credentials only call the IAM Credentials API, so Scopes is applied to the
+// impersonated token alone.
+func (c *Config) scopes() (baseScopes, clientScopes []string) {
+	clientScopes = defaultClientScopes
+	if len(c.Scopes) > 0 {
+		clientScopes = c.Scopes
+	}
+
+	if c.ImpersonateServiceAccount != "" {
+		return defaultClientScopes, clientScopes
 	}
+	return clientScopes, clientScopes
+}
+
+func (c *Config) loadAndValidate() error {
+	baseScopes, clientScopes := c.scopes()
+
+	var tokenSource oauth2.TokenSource
 
-	var client *http.Client
+	if c.AccessToken != "" {
+		log.Printf("[INFO] Authenticating using a static access token")
+		tokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.AccessToken})
 
-	if c.Credentials != "" {
+	} else if c.Credentials != "" {
 		contents, _, err := pathorcontents.Read(c.Credentials)
 		if err != nil {
 			return fmt.Errorf("Error loading credentials: %s", err)
 		}
 
-		// Assume account_file is a JSON string
-		if err := parseJSON(&account, contents); err != nil {
-			return fmt.Errorf("Error parsing credentials '%s': %s", contents, err)
-		}
-
-		// Get the token for use in our requests
-		log.Printf("[INFO] Requesting Google token...")
-		log.Printf("[INFO]   -- Email: %s", account.ClientEmail)
-		log.Printf("[INFO]   -- Scopes: %s", clientScopes)
-		log.Printf("[INFO]   -- Private Key Length: %d", len(account.PrivateKey))
-
-		conf := jwt.Config{
-			Email:      account.ClientEmail,
-			PrivateKey: []byte(account.PrivateKey),
-			Scopes:     clientScopes,
-			TokenURL:   "https://accounts.google.com/o/oauth2/token",
+		tokenSource, err = credentialsTokenSource(contents, baseScopes)
+		if err != nil {
+			return err
 		}
 
-		// Initiate an http.Client. The following GET request will be
-		// authorized and authenticated on the behalf of
-		// your service account.
-		client = conf.Client(oauth2.NoContext)
-
 	} else {
 		log.Printf("[INFO] Authenticating using DefaultClient")
 		err := error(nil)
-		client, err = google.DefaultClient(oauth2.NoContext, clientScopes...)
+		tokenSource, err = google.DefaultTokenSource(oauth2.NoContext, baseScopes...)
 		if err != nil {
 			return err
 		}
 	}
 
+	if c.ImpersonateServiceAccount != "" {
+		log.Printf("[INFO] Impersonating service account %s", c.ImpersonateServiceAccount)
+		var err error
+		tokenSource, err = newImpersonatedTokenSource(
+			tokenSource, c.ImpersonateServiceAccount, c.ImpersonateServiceAccountDelegates, clientScopes)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Initiate an http.Client. The following GET request will be
+	// authorized and authenticated on the behalf of
+	// your service account.
+	client := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: tokenSource,
+			Base:   c.newTransport(),
+		},
+	}
+
 	versionString := terraform.Version
 	prerelease := terraform.VersionPrerelease
 	if len(prerelease) > 0 {
@@ -84,6 +138,9 @@ func (c *Config) loadAndValidate() error {
 	}
 	userAgent := fmt.Sprintf(
 		"(%s %s) Terraform/%s", runtime.GOOS, runtime.GOARCH, versionString)
+	if c.UserAgentSuffix != "" {
+		userAgent = userAgent + " " + c.UserAgentSuffix
+	}
 
 	var err error
 
@@ -93,6 +150,9 @@ func (c *Config) loadAndValidate() error {
 		return err
 	}
 	c.clientStorage.UserAgent = userAgent
+	if c.StorageEndpoint != "" {
+		c.clientStorage.BasePath = normalizeEndpoint(c.StorageEndpoint)
+	}
 
 	log.Printf("[INFO] Instantiating Google Appengine Client...")
 	c.clientAppengine, err = appengine.New(client)
@@ -100,12 +160,110 @@ func (c *Config) loadAndValidate() error {
 		return err
 	}
 	c.clientAppengine.UserAgent = userAgent
+	if c.AppengineEndpoint != "" {
+		c.clientAppengine.BasePath = normalizeEndpoint(c.AppengineEndpoint)
+	}
+	c.operationPoller = newOperationPoller(c.clientAppengine)
 
 	return nil
 }
 
-// accountFile represents the structure of the account file JSON file.
+// newTransport builds the transport shared by every API client.  Requests
+// pass through the wrappers from the outside in: rate limiting, then the
+// quota project header, then debug logging so the log shows the headers that
+// are actually sent.
+func (c *Config) newTransport() http.RoundTripper {
+	var transport http.RoundTripper = http.DefaultTransport
+	if isDebugLogging() {
+		transport = &loggingTransport{transport: transport}
+	}
+	if c.UserProjectOverride {
+		billingProject := c.BillingProject
+		if billingProject == "" {
+			billingProject = c.Project
+		}
+		log.Printf("[INFO] Charging API quota to project %s", billingProject)
+		transport = &headerTransport{
+			transport: transport,
+			headers:   map[string]string{"X-Goog-User-Project": billingProject},
+		}
+	}
+	if c.RequestsPerSecond > 0 {
+		log.Printf("[INFO] Limiting API calls to %g per second", c.RequestsPerSecond)
+		transport = &rateLimitTransport{
+			transport: transport,
+			limiter:   rate.NewLimiter(rate.Limit(c.RequestsPerSecond), c.RequestBurst),
+		}
+	}
+	return transport
+}
+
+// credentialsTokenSource builds a token source for whichever kind of
+// credentials JSON it is given.  Service account keys are signed locally,
+// anything else (external accounts for workload identity federation,
+// authorized users) is left to the google package.
+func credentialsTokenSource(contents string, clientScopes []string) (oauth2.TokenSource, error) {
+	var account accountFile
+
+	// Assume account_file is a JSON string
+	if err := parseJSON(&account, contents); err != nil {
+		// the contents hold a private key, so never echo them back
+		return nil, fmt.Errorf("Error parsing credentials: %s", err)
+	}
+
+	switch account.Type {
+	case "", "service_account":
+		// Get the token for use in our requests
+		log.Printf("[INFO] Requesting Google token...")
+		log.Printf("[INFO]   -- Email: %s", redactEmail(account.ClientEmail))
+		log.Printf("[INFO]   -- Scopes: %s", clientScopes)
+
+		conf := jwt.Config{
+			Email:      account.ClientEmail,
+			PrivateKey: []byte(account.PrivateKey),
+			Scopes:     clientScopes,
+			TokenURL:   "https://accounts.google.com/o/oauth2/token",
+		}
+
+		return conf.TokenSource(oauth2.NoContext), nil
+
+	case "external_account", "authorized_user":
+		log.Printf("[INFO] Authenticating using %s credentials", account.Type)
+		creds, err := google.CredentialsFromJSON(oauth2.NoContext, []byte(contents), clientScopes...)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading %s credentials: %s", account.Type, err)
+		}
+
+		return creds.TokenSource, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported credentials type %q", account.Type)
+}
+
+// normalizeEndpoint makes sure the base path ends in "/", the generated
+// clients join it directly onto the request path
+func normalizeEndpoint(endpoint string) string {
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint = endpoint + "/"
+	}
+	return endpoint
+}
+
+// redactEmail keeps just enough of a service account email to tell accounts
+// apart in the logs, e.g. t***@my-project.iam.gserviceaccount.com
+func redactEmail(email string) string {
+	at := strings.Index(email, "@")
+	if at < 1 {
+		return "<redacted>"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// accountFile represents the structure of the account file JSON file.  Only
+// the fields needed to sign tokens for a service account are kept, other
+// credential types are parsed by the google package.
 type accountFile struct {
+	Type         string `json:"type"`
 	PrivateKeyId string `json:"private_key_id"`
 	PrivateKey   string `json:"private_key"`
 	ClientEmail  string `json:"client_email"`
@@ -118,3 +276,73 @@ func parseJSON(result interface{}, contents string) error {
 
 	return dec.Decode(result)
 }
+
+// impersonatedTokenSource mints short lived access tokens for a service
+// account through the IAM Credentials API, authenticated by the base
+// credentials
+type impersonatedTokenSource struct {
+	service   *iamcredentials.Service
+	name      string
+	delegates []string
+	scopes    []string
+}
+
+func newImpersonatedTokenSource(base oauth2.TokenSource, account string, delegates, scopes []string) (oauth2.TokenSource, error) {
+	service, err := iamcredentials.New(oauth2.NewClient(oauth2.NoContext, base))
+	if err != nil {
+		return nil, err
+	}
+
+	return impersonateWith(service, account, delegates, scopes), nil
+}
+
+// impersonateWith mints the tokens through the given IAM Credentials client
+func impersonateWith(service *iamcredentials.Service, account string, delegates, scopes []string) oauth2.TokenSource {
+	delegateNames := make([]string, 0, len(delegates))
+	for _, delegate := range delegates {
+		delegateNames = append(delegateNames, serviceAccountResourceName(delegate))
+	}
+
+	ts := &impersonatedTokenSource{
+		service:   service,
+		name:      serviceAccountResourceName(account),
+		delegates: delegateNames,
+		scopes:    scopes,
+	}
+
+	// only go back to the API once the current token has expired
+	return oauth2.ReuseTokenSource(nil, ts)
+}
+
+func (ts *impersonatedTokenSource) Token() (*oauth2.Token, error) {
+	request := &iamcredentials.GenerateAccessTokenRequest{
+		Delegates: ts.delegates,
+		Scope:     ts.scopes,
+		Lifetime:  "3600s",
+	}
+
+	resp, err := ts.service.Projects.ServiceAccounts.GenerateAccessToken(ts.name, request).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Error generating access token for %s: %s", ts.name, err)
+	}
+
+	expiry, err := time.Parse(time.RFC3339, resp.ExpireTime)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing access token expiry for %s: %s", ts.name, err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: resp.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      expiry,
+	}, nil
+}
+
+// serviceAccountResourceName accepts either an email or a full
+// projects/-/serviceAccounts/{email} name
+func serviceAccountResourceName(account string) string {
+	if strings.HasPrefix(account, "projects/") {
+		return account
+	}
+	return "projects/-/serviceAccounts/" + account
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func dataSourceAppengineArtifact() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceAppengineArtifactRead,
+
+		Schema: map[string]*schema.Schema{
+			"bucket": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			// the "directory" holding one sub directory per build
+			"prefix": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "",
+			},
+
+			"name_regex": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateRegexp,
+			},
+
+			// e.g. ">= 1.2, < 2.0"; builds without a version in their name
+			// are skipped when this is set
+			"version_constraint": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateVersionConstraint,
+			},
+
+			"key": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"version": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"keys": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			// path relative to key to source URL
+			"files": &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceAppengineArtifactRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	bucket := d.Get("bucket").(string)
+	prefix := normalizeKey(d.Get("prefix").(string))
+
+	var nameRegex *regexp.Regexp
+	if v := d.Get("name_regex").(string); v != "" {
+		var err error
+		nameRegex, err = regexp.Compile(v)
+		if err != nil {
+			return fmt.Errorf("name_regex is not a valid regular expression: %s", err)
+		}
+	}
+
+	var constraints version.Constraints
+	if v := d.Get("version_constraint").(string); v != "" {
+		var err error
+		constraints, err = version.NewConstraint(v)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, prefixes, err := listObjects(config, bucket, prefix, "/")
+	if err != nil {
+		return err
+	}
+
+	artifacts := filterArtifacts(prefix, prefixes, nameRegex, constraints)
+	if len(artifacts) == 0 {
+		return fmt.Errorf("no artifacts under gs://%s/%s match the given filters", bucket, prefix)
+	}
+	newest := artifacts[len(artifacts)-1]
+
+	objs, _, err := listObjects(config, bucket, newest.key, "")
+	if err != nil {
+		return err
+	}
+	files := make(map[string]string)
+	for name, info := range filesFromObjects(bucket, newest.key, objs) {
+		files[name] = info.SourceUrl
+	}
+
+	keys := make([]string, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		keys = append(keys, artifact.key)
+	}
+
+	d.SetId(bucket + "/" + newest.key)
+	d.Set("key", newest.key)
+	if newest.version != nil {
+		d.Set("version", newest.version.String())
+	} else {
+		d.Set("version", "")
+	}
+	d.Set("keys", keys)
+	d.Set("files", files)
+	return nil
+}
+
+type artifact struct {
+	key     string
+	name    string
+	version *version.Version
+}
+
+// artifactsByAge sorts builds oldest first: those with a version in their
+// name by that version, anything else before them by name
+type artifactsByAge []artifact
+
+func (a artifactsByAge) Len() int      { return len(a) }
+func (a artifactsByAge) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a artifactsByAge) Less(i, j int) bool {
+	switch {
+	case a[i].version == nil && a[j].version == nil:
+		return a[i].name < a[j].name
+	case a[i].version == nil:
+		return true
+	case a[j].version == nil:
+		return false
+	case a[i].version.Equal(a[j].version):
+		return a[i].name < a[j].name
+	}
+	return a[i].version.LessThan(a[j].version)
+}
+
+var artifactVersionRegexp = regexp.MustCompile(`\d+(\.\d+)*(-[0-9A-Za-z.-]+)?`)
+
+// filterArtifacts applies the data source's filters to the prefixes found
+// under parent and returns what is left, oldest first
+func filterArtifacts(parent string, prefixes []string, nameRegex *regexp.Regexp, constraints version.Constraints) []artifact {
+	artifacts := make([]artifact, 0, len(prefixes))
+	for _, key := range prefixes {
+		name := strings.TrimSuffix(strings.TrimPrefix(key, parent), "/")
+		if nameRegex != nil && !nameRegex.MatchString(name) {
+			continue
+		}
+
+		var v *version.Version
+		if match := artifactVersionRegexp.FindString(name); match != "" {
+			v, _ = version.NewVersion(match)
+		}
+		if constraints != nil && (v == nil || !constraints.Check(v)) {
+			continue
+		}
+
+		artifacts = append(artifacts, artifact{key: key, name: name, version: v})
+	}
+
+	sort.Sort(artifactsByAge(artifacts))
+	return artifacts
+}
+
+func validateRegexp(v interface{}, k string) (ws []string, errors []error) {
+	if _, err := regexp.Compile(v.(string)); err != nil {
+		errors = append(errors, fmt.Errorf("%q is not a valid regular expression: %s", k, err))
+	}
+	return
+}
+
+func validateVersionConstraint(v interface{}, k string) (ws []string, errors []error) {
+	if _, err := version.NewConstraint(v.(string)); err != nil {
+		errors = append(errors, fmt.Errorf("%q is not a valid version constraint: %s", k, err))
+	}
+	return
+}
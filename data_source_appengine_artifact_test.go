@@ -0,0 +1,53 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+)
+
+func TestFilterArtifacts(t *testing.T) {
+	prefixes := []string{
+		"builds/hxtest-1.10.0/",
+		"builds/hxtest-1.0-SNAPSHOT/",
+		"builds/other/",
+		"builds/hxtest-2.0.0/",
+		"builds/hxtest-1.2.0/",
+	}
+
+	cases := []struct {
+		nameRegex   string
+		constraint  string
+		expectCount int
+		expectKey   string
+	}{
+		{"", "", 5, "builds/hxtest-2.0.0/"},
+		{"^hxtest-", "", 4, "builds/hxtest-2.0.0/"},
+		{"", ">= 1.2, < 2.0", 2, "builds/hxtest-1.10.0/"},
+		{"^oth", "", 1, "builds/other/"},
+		{"^nothing", "", 0, ""},
+	}
+
+	for i, tc := range cases {
+		var nameRegex *regexp.Regexp
+		if tc.nameRegex != "" {
+			nameRegex = regexp.MustCompile(tc.nameRegex)
+		}
+		var constraints version.Constraints
+		if tc.constraint != "" {
+			constraints, _ = version.NewConstraint(tc.constraint)
+		}
+
+		artifacts := filterArtifacts("builds/", prefixes, nameRegex, constraints)
+		if len(artifacts) != tc.expectCount {
+			t.Fatalf("case %d: expected %d artifacts, got %v", i, tc.expectCount, artifacts)
+		}
+		if tc.expectCount == 0 {
+			continue
+		}
+		if newest := artifacts[len(artifacts)-1]; newest.key != tc.expectKey {
+			t.Fatalf("case %d: expected newest %s, got %s", i, tc.expectKey, newest.key)
+		}
+	}
+}
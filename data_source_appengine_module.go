@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"google.golang.org/api/appengine/v1"
+)
+
+func dataSourceAppengineModule() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceAppengineModuleRead,
+
+		Schema: map[string]*schema.Schema{
+			"project": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+
+			"module_name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			// version id to share of traffic, e.g. "0.5"
+			"traffic_split": &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+			},
+
+			"shard_by": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"versions": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"latest_serving_version": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"url": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceAppengineModuleRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	project := getProject(d, config)
+	moduleName := d.Get("module_name").(string)
+
+	moduleService := appengine.NewAppsServicesService(config.clientAppengine)
+	module, err := moduleService.Get(project, moduleName).Do()
+	if err != nil {
+		return err
+	}
+
+	versions, err := listVersions(config, project, moduleName)
+	if err != nil {
+		return err
+	}
+
+	versionIds := make([]string, 0, len(versions))
+	for _, version := range versions {
+		versionIds = append(versionIds, version.Id)
+	}
+
+	latestServing := ""
+	if latest := latestServingVersion(versions); latest != nil {
+		latestServing = latest.Id
+	}
+
+	split := make(map[string]string)
+	shardBy := ""
+	if module.Split != nil {
+		for versionId, share := range module.Split.Allocations {
+			split[versionId] = strconv.FormatFloat(share, 'f', -1, 64)
+		}
+		shardBy = module.Split.ShardBy
+	}
+
+	d.Set("project", project)
+	d.SetId(module.Name)
+	d.Set("name", module.Name)
+	d.Set("traffic_split", split)
+	d.Set("shard_by", shardBy)
+	d.Set("versions", versionIds)
+	d.Set("latest_serving_version", latestServing)
+	d.Set("url", moduleURL(project, moduleName))
+	return nil
+}
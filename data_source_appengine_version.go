@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"google.golang.org/api/appengine/v1"
+)
+
+func dataSourceAppengineVersion() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceAppengineVersionRead,
+
+		Schema: map[string]*schema.Schema{
+			"project": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+
+			"module_name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			// left empty this picks the most recently created serving version
+			"version": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"serving_status": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"creation_time": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"deployer": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"runtime": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"instance_class": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"scaling": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"type": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+
+						"min_idle_instances": &schema.Schema{
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+
+						"max_idle_instances": &schema.Schema{
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+
+						"min_pending_latency": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+
+						"max_pending_latency": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+
+						"max_instances": &schema.Schema{
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+
+						"instances": &schema.Schema{
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+					},
+				},
+			},
+
+			"url": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceAppengineVersionRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	project := getProject(d, config)
+	moduleName := d.Get("module_name").(string)
+
+	var version *appengine.Version
+	if versionId := d.Get("version").(string); versionId != "" {
+		moduleVersionService := appengine.NewAppsServicesVersionsService(config.clientAppengine)
+		found, err := moduleVersionService.Get(project, moduleName, versionId).View("FULL").Do()
+		if err != nil {
+			return err
+		}
+		version = found
+	} else {
+		versions, err := listVersions(config, project, moduleName)
+		if err != nil {
+			return err
+		}
+		version = latestServingVersion(versions)
+		if version == nil {
+			return fmt.Errorf("module %s has no serving versions", moduleName)
+		}
+	}
+
+	d.Set("project", project)
+	d.SetId(version.Name)
+	d.Set("version", version.Id)
+	d.Set("name", version.Name)
+	d.Set("serving_status", version.ServingStatus)
+	d.Set("creation_time", version.CreateTime)
+	d.Set("deployer", version.CreatedBy)
+	d.Set("runtime", version.Runtime)
+	d.Set("instance_class", version.InstanceClass)
+	d.Set("scaling", flattenVersionScaling(version))
+	d.Set("url", servingURL(project, moduleName, version))
+	return nil
+}
+
+// listVersions pages through every version of the module, with the full view
+// so that scaling and status settings are populated
+func listVersions(config *Config, project, moduleName string) ([]*appengine.Version, error) {
+	moduleVersionService := appengine.NewAppsServicesVersionsService(config.clientAppengine)
+	listCall := moduleVersionService.List(project, moduleName).View("FULL")
+
+	versions := make([]*appengine.Version, 0)
+	for {
+		resp, err := listCall.Do()
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, resp.Versions...)
+
+		if resp.NextPageToken == "" {
+			break
+		}
+		listCall = listCall.PageToken(resp.NextPageToken)
+	}
+
+	return versions, nil
+}
+
+// latestServingVersion picks the most recently created version that is
+// currently serving, or nil if none are
+func latestServingVersion(versions []*appengine.Version) *appengine.Version {
+	var latest *appengine.Version
+	var latestCreated time.Time
+	for _, version := range versions {
+		if version.ServingStatus != "SERVING" {
+			continue
+		}
+		created, _ := time.Parse(time.RFC3339Nano, version.CreateTime)
+		if latest == nil || created.After(latestCreated) {
+			latest = version
+			latestCreated = created
+		}
+	}
+	return latest
+}
+
+func flattenVersionScaling(version *appengine.Version) []map[string]interface{} {
+	switch {
+	case version.AutomaticScaling != nil:
+		return []map[string]interface{}{
+			map[string]interface{}{
+				"type":                "automatic",
+				"min_idle_instances":  int(version.AutomaticScaling.MinIdleInstances),
+				"max_idle_instances":  int(version.AutomaticScaling.MaxIdleInstances),
+				"min_pending_latency": version.AutomaticScaling.MinPendingLatency,
+				"max_pending_latency": version.AutomaticScaling.MaxPendingLatency,
+			},
+		}
+	case version.BasicScaling != nil:
+		return []map[string]interface{}{
+			map[string]interface{}{
+				"type":          "basic",
+				"max_instances": int(version.BasicScaling.MaxInstances),
+			},
+		}
+	case version.ManualScaling != nil:
+		return []map[string]interface{}{
+			map[string]interface{}{
+				"type":      "manual",
+				"instances": int(version.ManualScaling.Instances),
+			},
+		}
+	}
+	return nil
+}
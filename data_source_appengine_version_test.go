@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"google.golang.org/api/appengine/v1"
+)
+
+func TestLatestServingVersion(t *testing.T) {
+	versions := []*appengine.Version{
+		&appengine.Version{Id: "old", ServingStatus: "SERVING", CreateTime: "2016-03-01T10:00:00.000Z"},
+		&appengine.Version{Id: "new", ServingStatus: "SERVING", CreateTime: "2016-03-02T10:00:00.000Z"},
+		&appengine.Version{Id: "stopped", ServingStatus: "STOPPED", CreateTime: "2016-03-03T10:00:00.000Z"},
+	}
+
+	latest := latestServingVersion(versions)
+	if latest == nil || latest.Id != "new" {
+		t.Fatalf("expected version new, got %v", latest)
+	}
+
+	if latestServingVersion(versions[2:]) != nil {
+		t.Fatalf("expected no serving version")
+	}
+}
+
+func TestServingURL(t *testing.T) {
+	cases := map[string]struct {
+		version  *appengine.Version
+		expected string
+	}{
+		"reported by the API": {
+			version:  &appengine.Version{Id: "foobaz", VersionUrl: "https://foobaz-dot-foobar-dot-hx-test.ew.r.appspot.com"},
+			expected: "https://foobaz-dot-foobar-dot-hx-test.ew.r.appspot.com",
+		},
+		"constructed": {
+			version:  &appengine.Version{Id: "foobaz"},
+			expected: "https://foobaz-dot-foobar-dot-hx-test.appspot.com",
+		},
+	}
+
+	for tn, tc := range cases {
+		if actual := servingURL("hx-test", "foobar", tc.version); actual != tc.expected {
+			t.Fatalf("%s: expected %q, got %q", tn, tc.expected, actual)
+		}
+	}
+}
+
+func TestAccAppengineVersionDataSource(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccAppengineVersionDataSource,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.googleappengine_version.foobar", "version", "foobaz"),
+					resource.TestCheckResourceAttr("data.googleappengine_version.foobar", "serving_status", "SERVING"),
+					resource.TestCheckResourceAttr("data.googleappengine_module.foobar", "module_name", "foobar"),
+				),
+			},
+		},
+	})
+}
+
+var testAccAppengineVersionDataSource = testAccAppengine + `
+data "googleappengine_version" "foobar" {
+	module_name = "${googleappengine_app.foobar.module_name}"
+	version = "${googleappengine_app.foobar.version}"
+}
+
+data "googleappengine_module" "foobar" {
+	module_name = "${googleappengine_app.foobar.module_name}"
+}`
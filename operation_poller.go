@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/googleapi"
+)
+
+const operationPollInterval = 10 * time.Second
+
+// operationPoller waits on long running operations for every resource in
+// the run from a single goroutine.  Each in-flight operation is fetched once
+// per interval however many callers are waiting on it, instead of every
+// resource sleeping and polling on its own.
+type operationPoller struct {
+	// sleep waits out the interval between rounds of polling
+	sleep func()
+	get   func(project, operationId string) (*appengine.Operation, error)
+
+	mu      sync.Mutex
+	running bool
+	pending map[string]*pendingOperation
+}
+
+type pendingOperation struct {
+	project     string
+	operationId string
+	waiters     []chan error
+}
+
+func newOperationPoller(client *appengine.Service) *operationPoller {
+	operationService := appengine.NewAppsOperationsService(client)
+	return &operationPoller{
+		sleep: func() {
+			time.Sleep(operationPollInterval)
+		},
+		get: func(project, operationId string) (*appengine.Operation, error) {
+			return operationService.Get(project, operationId).Do()
+		},
+		pending: make(map[string]*pendingOperation),
+	}
+}
+
+// wait blocks until the operation is done, returning its error if it failed
+func (p *operationPoller) wait(operation *appengine.Operation, project string) error {
+	if operation.Done {
+		return operationError(operation)
+	}
+
+	done := make(chan error, 1)
+
+	p.mu.Lock()
+	pending, ok := p.pending[operation.Name]
+	if !ok {
+		//  the operation's id is the last part of apps/{project}/operations/{id}
+		pending = &pendingOperation{
+			project:     project,
+			operationId: operation.Name[strings.LastIndex(operation.Name, "/")+1:],
+		}
+		p.pending[operation.Name] = pending
+	}
+	pending.waiters = append(pending.waiters, done)
+	if !p.running {
+		p.running = true
+		go p.run()
+	}
+	p.mu.Unlock()
+
+	return <-done
+}
+
+// run polls until nothing is left to wait on, then exits; the next call to
+// wait starts it again
+func (p *operationPoller) run() {
+	for {
+		p.sleep()
+
+		p.mu.Lock()
+		if len(p.pending) == 0 {
+			p.running = false
+			p.mu.Unlock()
+			return
+		}
+		names := make([]string, 0, len(p.pending))
+		for name := range p.pending {
+			names = append(names, name)
+		}
+		p.mu.Unlock()
+
+		for _, name := range names {
+			p.mu.Lock()
+			pending := p.pending[name]
+			p.mu.Unlock()
+
+			operation, err := p.get(pending.project, pending.operationId)
+			if isRetryable(err) {
+				log.Printf("[DEBUG] Polling operation %s failed, trying again next round: %s", name, err)
+				continue
+			}
+			if err == nil {
+				if !operation.Done {
+					continue
+				}
+				err = operationError(operation)
+			}
+
+			p.mu.Lock()
+			waiters := pending.waiters
+			delete(p.pending, name)
+			p.mu.Unlock()
+
+			for _, done := range waiters {
+				done <- err
+			}
+		}
+	}
+}
+
+// isRetryable reports whether a failed poll is worth repeating, rather than
+// giving up on an operation that may well still succeed
+func isRetryable(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	return ok && (gerr.Code == 429 || gerr.Code >= 500)
+}
+
+func operationError(operation *appengine.Operation) error {
+	//   if it failed, explode
+	if operation.Error != nil {
+		log.Printf("[DEBUG] status list from bad operation: %q", operation.Error.Details)
+		return fmt.Errorf("%s", operation.Error.Message)
+	}
+	return nil
+}
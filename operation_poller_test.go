@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// newTestOperationPoller returns a poller that only polls when the test sends
+// on tick, and a fake Operations.Get that counts its calls per operation.  The
+// "ok" and "failing" operations finish on their third poll, "throttled" hits
+// the quota on its first two and then succeeds, and "missing" is never found;
+// any other operation is done when first polled.
+func newTestOperationPoller() (*operationPoller, chan struct{}, func(string) int) {
+	tick := make(chan struct{})
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+
+	poller := &operationPoller{
+		sleep: func() {
+			<-tick
+		},
+		get: func(project, operationId string) (*appengine.Operation, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[operationId]++
+
+			name := "apps/" + project + "/operations/" + operationId
+			switch {
+			case operationId == "missing":
+				return nil, fmt.Errorf("operation %s not found", name)
+			case operationId == "throttled" && calls[operationId] < 3:
+				return nil, &googleapi.Error{Code: 429, Message: "Quota exceeded"}
+			case (operationId == "ok" || operationId == "failing") && calls[operationId] < 3:
+				return &appengine.Operation{Name: name}, nil
+			case operationId == "failing":
+				return &appengine.Operation{Name: name, Done: true, Error: &appengine.Status{Message: "deploy failed"}}, nil
+			}
+			return &appengine.Operation{Name: name, Done: true}, nil
+		},
+		pending: make(map[string]*pendingOperation),
+	}
+
+	count := func(operationId string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[operationId]
+	}
+
+	return poller, tick, count
+}
+
+// waitFor checks condition under the poller's lock until it holds
+func waitFor(t *testing.T, poller *operationPoller, description string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		poller.mu.Lock()
+		ok := condition()
+		poller.mu.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOperationPoller(t *testing.T) {
+	poller, tick, count := newTestOperationPoller()
+
+	cases := map[string]string{
+		"ok":        "",
+		"failing":   "deploy failed",
+		"throttled": "",
+		"missing":   "operation apps/my-project/operations/missing not found",
+	}
+
+	var wg sync.WaitGroup
+	var errsMu sync.Mutex
+	errs := make(map[string][]error)
+	for operationId := range cases {
+		// two waiters on the same operation share its polls
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(operationId string) {
+				defer wg.Done()
+				err := poller.wait(&appengine.Operation{Name: "apps/my-project/operations/" + operationId}, "my-project")
+				errsMu.Lock()
+				errs[operationId] = append(errs[operationId], err)
+				errsMu.Unlock()
+			}(operationId)
+		}
+	}
+
+	// every waiter is registered before the first round of polling
+	waitFor(t, poller, "all waiters to register", func() bool {
+		if len(poller.pending) != len(cases) {
+			return false
+		}
+		for _, pending := range poller.pending {
+			if len(pending.waiters) != 2 {
+				return false
+			}
+		}
+		return true
+	})
+
+	for i := 0; i < 3; i++ {
+		tick <- struct{}{}
+	}
+	wg.Wait()
+
+	for operationId, expected := range cases {
+		if len(errs[operationId]) != 2 {
+			t.Fatalf("%s: expected both waiters to return, got %v", operationId, errs[operationId])
+		}
+		for _, err := range errs[operationId] {
+			if expected == "" && err != nil {
+				t.Errorf("%s: unexpected error: %s", operationId, err)
+			}
+			if expected != "" && (err == nil || err.Error() != expected) {
+				t.Errorf("%s: expected error %q, got %v", operationId, expected, err)
+			}
+		}
+	}
+
+	if count("ok") != 3 || count("failing") != 3 || count("throttled") != 3 || count("missing") != 1 {
+		t.Errorf("expected each operation to be polled once per round until done, got ok=%d failing=%d throttled=%d missing=%d",
+			count("ok"), count("failing"), count("throttled"), count("missing"))
+	}
+
+	poller.mu.Lock()
+	if len(poller.pending) != 0 {
+		t.Errorf("expected nothing left pending, got %v", poller.pending)
+	}
+	poller.mu.Unlock()
+
+	// with nothing pending the next round stops the poller
+	tick <- struct{}{}
+	waitFor(t, poller, "the poller to stop", func() bool {
+		return !poller.running
+	})
+
+	// and the next operation starts it again
+	done := make(chan error, 1)
+	go func() {
+		done <- poller.wait(&appengine.Operation{Name: "apps/my-project/operations/later"}, "my-project")
+	}()
+	waitFor(t, poller, "the poller to restart", func() bool {
+		return poller.running && poller.pending["apps/my-project/operations/later"] != nil
+	})
+	tick <- struct{}{}
+	if err := <-done; err != nil {
+		t.Errorf("later: unexpected error: %s", err)
+	}
+	if count("later") != 1 {
+		t.Errorf("expected later to be polled once, got %d", count("later"))
+	}
+}
+
+func TestOperationPoller_alreadyDone(t *testing.T) {
+	poller := &operationPoller{
+		sleep: func() {
+			t.Errorf("unexpected round of polling")
+		},
+		get: func(project, operationId string) (*appengine.Operation, error) {
+			t.Errorf("unexpected poll of %s", operationId)
+			return nil, nil
+		},
+		pending: make(map[string]*pendingOperation),
+	}
+
+	err := poller.wait(&appengine.Operation{Name: "apps/my-project/operations/done", Done: true}, "my-project")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/hashicorp/terraform/helper/pathorcontents"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
+	"google.golang.org/api/googleapi"
 )
 
 // Provider returns a terraform.ResourceProvider.
@@ -20,6 +21,91 @@ func Provider() terraform.ResourceProvider {
 				ValidateFunc: validateCredentials,
 			},
 
+			"access_token": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("GOOGLE_OAUTH_ACCESS_TOKEN", nil),
+				ConflictsWith: []string{"credentials", "account_file"},
+			},
+
+			"account_file": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ValidateFunc:  validateAccountFile,
+				Deprecated:    "Use the credentials field instead",
+				ConflictsWith: []string{"credentials", "access_token"},
+			},
+
+			"impersonate_service_account": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GOOGLE_IMPERSONATE_SERVICE_ACCOUNT", nil),
+			},
+
+			"impersonate_service_account_delegates": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"scopes": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"appengine_endpoint": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GOOGLE_APPENGINE_ENDPOINT", nil),
+			},
+
+			"storage_endpoint": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GOOGLE_STORAGE_ENDPOINT", nil),
+			},
+
+			"user_agent_suffix": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GOOGLE_USER_AGENT_SUFFIX", nil),
+			},
+
+			"billing_project": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GOOGLE_BILLING_PROJECT", nil),
+			},
+
+			// charge quota and billing to billing_project, or failing that
+			// project, rather than the project owning the credentials
+			"user_project_override": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("USER_PROJECT_OVERRIDE", false),
+			},
+
+			// client side limit on API calls across all resources, to stay
+			// under per-minute quotas when many are planned at once
+			"requests_per_second": &schema.Schema{
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				Default:      0.0,
+				ValidateFunc: validateRequestsPerSecond,
+			},
+
+			"request_burst": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      1,
+				ValidateFunc: validateRequestBurst,
+			},
+
 			"project": &schema.Schema{
 				Type:        schema.TypeString,
 				Required:    true,
@@ -33,8 +119,15 @@ func Provider() terraform.ResourceProvider {
 			},
 		},
 
+		DataSourcesMap: map[string]*schema.Resource{
+			"googleappengine_artifact": dataSourceAppengineArtifact(),
+			"googleappengine_module":   dataSourceAppengineModule(),
+			"googleappengine_version":  dataSourceAppengineVersion(),
+		},
+
 		ResourcesMap: map[string]*schema.Resource{
 			"googleappengine_app":               resourceAppengine(),
+			"googleappengine_version_retention": resourceAppengineVersionRetention(),
 		},
 
 		ConfigureFunc: providerConfigure,
@@ -48,8 +141,30 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	}
 	config := Config{
 		Credentials: credentials,
+		AccessToken: d.Get("access_token").(string),
 		Project:     d.Get("project").(string),
 		Region:      d.Get("region").(string),
+
+		ImpersonateServiceAccount: d.Get("impersonate_service_account").(string),
+
+		AppengineEndpoint: d.Get("appengine_endpoint").(string),
+		StorageEndpoint:   d.Get("storage_endpoint").(string),
+
+		UserAgentSuffix: d.Get("user_agent_suffix").(string),
+
+		BillingProject:      d.Get("billing_project").(string),
+		UserProjectOverride: d.Get("user_project_override").(bool),
+
+		RequestsPerSecond: d.Get("requests_per_second").(float64),
+		RequestBurst:      d.Get("request_burst").(int),
+	}
+
+	for _, scope := range d.Get("scopes").([]interface{}) {
+		config.Scopes = append(config.Scopes, scope.(string))
+	}
+
+	for _, delegate := range d.Get("impersonate_service_account_delegates").([]interface{}) {
+		config.ImpersonateServiceAccountDelegates = append(config.ImpersonateServiceAccountDelegates, delegate.(string))
 	}
 
 	if err := config.loadAndValidate(); err != nil {
@@ -59,6 +174,22 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	return &config, nil
 }
 
+// getProject returns the project set on the resource, falling back to the
+// provider's project when it has none
+func getProject(d *schema.ResourceData, config *Config) string {
+	if v, ok := d.GetOk("project"); ok {
+		return v.(string)
+	}
+	return config.Project
+}
+
+// isNotFound reports whether an API call failed because what it asked for
+// does not exist
+func isNotFound(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	return ok && gerr.Code == 404
+}
+
 func validateAccountFile(v interface{}, k string) (warnings []string, errors []error) {
 	if v == nil {
 		return
@@ -83,7 +214,7 @@ your configuration to use ${file("filename.json")} instead.`)
 	var account accountFile
 	if err := json.Unmarshal([]byte(contents), &account); err != nil {
 		errors = append(errors,
-			fmt.Errorf("account_file not valid JSON '%s': %s", contents, err))
+			fmt.Errorf("account_file not valid JSON: %s", err))
 	}
 
 	return
@@ -97,8 +228,30 @@ func validateCredentials(v interface{}, k string) (warnings []string, errors []e
 	var account accountFile
 	if err := json.Unmarshal([]byte(creds), &account); err != nil {
 		errors = append(errors,
-			fmt.Errorf("credentials are not valid JSON '%s': %s", creds, err))
+			fmt.Errorf("credentials are not valid JSON: %s", err))
+		return
+	}
+
+	switch account.Type {
+	case "", "service_account", "external_account", "authorized_user":
+	default:
+		errors = append(errors, fmt.Errorf(
+			"credentials type %q is not supported, expected service_account, external_account or authorized_user", account.Type))
+	}
+
+	return
+}
+
+func validateRequestsPerSecond(v interface{}, k string) (warnings []string, errors []error) {
+	if v.(float64) < 0 {
+		errors = append(errors, fmt.Errorf("%q must not be negative", k))
 	}
+	return
+}
 
+func validateRequestBurst(v interface{}, k string) (warnings []string, errors []error) {
+	if v.(int) < 1 {
+		errors = append(errors, fmt.Errorf("%q must be at least 1", k))
+	}
 	return
 }
@@ -50,3 +50,105 @@ func testAccPreCheck(t *testing.T) {
 		t.Fatal("GOOGLE_REGION must be set to us-central1 for acceptance tests")
 	}
 }
+
+func TestProviderConfigure_credentials(t *testing.T) {
+	contents, err := ioutil.ReadFile(testFakeCredentialsPath)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	raw := map[string]interface{}{
+		"credentials": string(contents),
+		"project":     "my-gce-project",
+		"region":      "us-central1",
+	}
+	testProviderConfigure(t, raw, string(contents))
+}
+
+func TestProviderConfigure_accountFile(t *testing.T) {
+	if v := os.Getenv("GOOGLE_CREDENTIALS"); v != "" {
+		os.Unsetenv("GOOGLE_CREDENTIALS")
+		defer os.Setenv("GOOGLE_CREDENTIALS", v)
+	}
+
+	raw := map[string]interface{}{
+		"account_file": testFakeCredentialsPath,
+		"project":      "my-gce-project",
+		"region":       "us-central1",
+	}
+	testProviderConfigure(t, raw, testFakeCredentialsPath)
+}
+
+func TestProviderValidate_accessTokenConflicts(t *testing.T) {
+	for _, k := range []string{"credentials", "account_file"} {
+		c := terraform.NewResourceConfigRaw(map[string]interface{}{
+			"access_token": "ya29.fake",
+			k:              testFakeCredentialsPath,
+			"project":      "my-gce-project",
+		})
+
+		_, errs := Provider().(*schema.Provider).Validate(c)
+		if len(errs) == 0 {
+			t.Fatalf("expected access_token and %s to conflict", k)
+		}
+	}
+}
+
+func testProviderConfigure(t *testing.T, raw map[string]interface{}, expectedCredentials string) {
+	d := schema.TestResourceDataRaw(t, Provider().(*schema.Provider).Schema, raw)
+
+	meta, err := providerConfigure(d)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	config := meta.(*Config)
+	if config.Credentials != expectedCredentials {
+		t.Fatalf("expected credentials %q, got %q", expectedCredentials, config.Credentials)
+	}
+	if config.Project != "my-gce-project" {
+		t.Fatalf("expected project my-gce-project, got %q", config.Project)
+	}
+	if config.clientAppengine == nil || config.clientStorage == nil {
+		t.Fatalf("expected clients to be configured")
+	}
+}
+
+func TestValidateAccountFile(t *testing.T) {
+	cases := []struct {
+		value       string
+		expectErr   bool
+		expectWarns bool
+	}{
+		{"", false, false},
+		{testFakeCredentialsPath, false, true},
+		{`{"client_email": "foo@bar.com"}`, false, false},
+		{"{this is not json}", true, false},
+	}
+
+	for _, tc := range cases {
+		warnings, errors := validateAccountFile(tc.value, "account_file")
+		if (len(errors) > 0) != tc.expectErr {
+			t.Fatalf("%q: expected error %t, got %v", tc.value, tc.expectErr, errors)
+		}
+		if (len(warnings) > 0) != tc.expectWarns {
+			t.Fatalf("%q: expected warnings %t, got %v", tc.value, tc.expectWarns, warnings)
+		}
+	}
+}
+
+func TestGetProject(t *testing.T) {
+	config := &Config{Project: "provider-project"}
+
+	d := schema.TestResourceDataRaw(t, resourceAppengine().Schema, map[string]interface{}{})
+	if project := getProject(d, config); project != "provider-project" {
+		t.Fatalf("expected provider-project, got %s", project)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceAppengine().Schema, map[string]interface{}{
+		"project": "resource-project",
+	})
+	if project := getProject(d, config); project != "resource-project" {
+		t.Fatalf("expected resource-project, got %s", project)
+	}
+}
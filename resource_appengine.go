@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"log"
 	"time"
+	"sort"
+	"regexp"
 	"strings"
 	"strconv"
+	"crypto/sha1"
+	"encoding/hex"
 	"text/template"
 	"github.com/hashicorp/terraform/helper/schema"
-	"google.golang.org/api/appengine/v1beta4"
+	"google.golang.org/api/appengine/v1"
 	"google.golang.org/api/storage/v1"
 )
 
@@ -17,31 +21,82 @@ func resourceAppengine() *schema.Resource {
 	return &schema.Resource{
 		Create: resourceAppengineCreate,
 		Read:   resourceAppengineRead,
+		Update: resourceAppengineUpdate,
 		Delete: resourceAppengineDelete,
 
+		CustomizeDiff: resourceAppengineCustomizeDiff,
+
+		SchemaVersion: 2,
+		MigrateState:  resourceAppengineMigrateState,
+
 		Schema: map[string]*schema.Schema{
-			"moduleName": &schema.Schema{
+			"project": &schema.Schema{
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
+				Computed: true,
 				ForceNew: true,
 			},
 
+			"module_name": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateModuleName,
+			},
+
+			"moduleName": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				ValidateFunc:  validateModuleName,
+				Deprecated:    "Use module_name instead",
+				ConflictsWith: []string{"module_name"},
+			},
+
+			// left empty an id is generated from the deployment, see
+			// generateVersionId
 			"version": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateVersionId,
+			},
+
+			"gstorage_bucket": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateBucketName,
 			},
 
 			"gstorageBucket": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				ValidateFunc:  validateBucketName,
+				Deprecated:    "Use gstorage_bucket instead",
+				ConflictsWith: []string{"gstorage_bucket"},
+			},
+
+			"gstorage_key": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
 			},
 
 			"gstorageKey": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				Deprecated:    "Use gstorage_key instead",
+				ConflictsWith: []string{"gstorage_key"},
 			},
 			
 			"resource_version": &schema.Schema{
@@ -57,43 +112,378 @@ func resourceAppengine() *schema.Resource {
 				Type:     schema.TypeList,
 				Optional: true,
 				ForceNew: true,
+				MaxItems: 1,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
+						"min_idle_instances": &schema.Schema{
+							Type:             schema.TypeInt,
+							Optional:         true,
+							Default:          1,
+							DiffSuppressFunc: suppressWhenAliasMatches("minIdleInstances"),
+						},
+
+						"max_idle_instances": &schema.Schema{
+							Type:             schema.TypeInt,
+							Optional:         true,
+							Default:          3,
+							DiffSuppressFunc: suppressWhenAliasMatches("maxIdleInstances"),
+						},
+
+						"min_pending_latency": &schema.Schema{
+							Type:             schema.TypeString,
+							Optional:         true,
+							Default:          "Automatic",
+							ValidateFunc:     validateLatency,
+							DiffSuppressFunc: suppressWhenAliasMatches("minPendingLatency"),
+						},
+
+						"max_pending_latency": &schema.Schema{
+							Type:             schema.TypeString,
+							Optional:         true,
+							Default:          "Automatic",
+							ValidateFunc:     validateLatency,
+							DiffSuppressFunc: suppressWhenAliasMatches("maxPendingLatency"),
+						},
+
 						"minIdleInstances": &schema.Schema{
-							Type:     schema.TypeInt,
-							Optional: true,
-							Default:  "1",
+							Type:             schema.TypeInt,
+							Optional:         true,
+							Deprecated:       "Use min_idle_instances instead",
+							DiffSuppressFunc: suppressAliasMatches("min_idle_instances"),
 						},
 
 						"maxIdleInstances": &schema.Schema{
-							Type:     schema.TypeInt,
-							Optional: true,
-							Default: "3",
+							Type:             schema.TypeInt,
+							Optional:         true,
+							Deprecated:       "Use max_idle_instances instead",
+							DiffSuppressFunc: suppressAliasMatches("max_idle_instances"),
 						},
 
 						"minPendingLatency": &schema.Schema{
+							Type:             schema.TypeString,
+							Optional:         true,
+							Deprecated:       "Use min_pending_latency instead",
+							ValidateFunc:     validateLatency,
+							DiffSuppressFunc: suppressAliasMatches("min_pending_latency"),
+						},
+
+						"maxPendingLatency": &schema.Schema{
+							Type:             schema.TypeString,
+							Optional:         true,
+							Deprecated:       "Use max_pending_latency instead",
+							ValidateFunc:     validateLatency,
+							DiffSuppressFunc: suppressAliasMatches("max_pending_latency"),
+						},
+					},
+				},
+			},
+			"libraries": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				ForceNew: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": &schema.Schema{
+							Type:     schema.TypeString,
+							Required: true,
+							ForceNew: true,
+						},
+
+						"version": &schema.Schema{
+							Type:     schema.TypeString,
+							Required: true,
+							ForceNew: true,
+						},
+					},
+				},
+			},
+
+			"error_handlers": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				ForceNew: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"error_code": &schema.Schema{
+							Type:         schema.TypeString,
+							Optional:     true,
+							ForceNew:     true,
+							Default:      "default",
+							ValidateFunc: validateErrorCode,
+						},
+
+						"static_file": &schema.Schema{
+							Type:     schema.TypeString,
+							Required: true,
+							ForceNew: true,
+						},
+
+						"mime_type": &schema.Schema{
 							Type:     schema.TypeString,
 							Optional: true,
-							Default: "Automatic",
+							ForceNew: true,
 						},
+					},
+				},
+			},
 
-						"maxPendingLatency": &schema.Schema{
+			"beta_settings": &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+			},
+
+			"inbound_services": &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateInboundService,
+				},
+				Set: schema.HashString,
+			},
+
+			"instance_class": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateInstanceClass,
+			},
+
+			"vm": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				ForceNew: true,
+				Default:  false,
+			},
+
+			"resources": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"cpu": &schema.Schema{
+							Type:     schema.TypeFloat,
+							Optional: true,
+							ForceNew: true,
+						},
+
+						"memory_gb": &schema.Schema{
+							Type:     schema.TypeFloat,
+							Optional: true,
+							ForceNew: true,
+						},
+
+						"disk_gb": &schema.Schema{
+							Type:     schema.TypeFloat,
+							Optional: true,
+							ForceNew: true,
+						},
+					},
+				},
+			},
+
+			"network": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": &schema.Schema{
 							Type:     schema.TypeString,
 							Optional: true,
-							Default: "Automatic",
+							ForceNew: true,
+						},
+
+						"forwarded_ports": &schema.Schema{
+							Type:     schema.TypeList,
+							Optional: true,
+							ForceNew: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+
+						"instance_tag": &schema.Schema{
+							Type:     schema.TypeString,
+							Optional: true,
+							ForceNew: true,
 						},
 					},
 				},
 			},
-			"topicName": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
+
+			"health_check": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Computed: true,
 				ForceNew: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"check_interval": &schema.Schema{
+							Type:         schema.TypeString,
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateSeconds,
+						},
+
+						"timeout": &schema.Schema{
+							Type:         schema.TypeString,
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateSeconds,
+						},
+
+						"unhealthy_threshold": &schema.Schema{
+							Type:     schema.TypeInt,
+							Optional: true,
+							ForceNew: true,
+						},
+
+						"healthy_threshold": &schema.Schema{
+							Type:     schema.TypeInt,
+							Optional: true,
+							ForceNew: true,
+						},
+
+						"restart_threshold": &schema.Schema{
+							Type:     schema.TypeInt,
+							Optional: true,
+							ForceNew: true,
+						},
+
+						"disable_health_check": &schema.Schema{
+							Type:     schema.TypeBool,
+							Optional: true,
+							ForceNew: true,
+						},
+					},
+				},
 			},
+			"topic_name": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateTopicName,
+			},
+
+			"topicName": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				ValidateFunc:  validateTopicName,
+				Deprecated:    "Use topic_name instead",
+				ConflictsWith: []string{"topic_name"},
+			},
+
 			"servingStatus": &schema.Schema{
+				Type:       schema.TypeString,
+				Computed:   true,
+				Deprecated: "Use serving_status instead",
+			},
+
+			"serving_status": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateServingStatus,
+			},
+
+			"promote": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			"rollout": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"steps": &schema.Schema{
+							Type:     schema.TypeList,
+							Required: true,
+							Elem: &schema.Schema{
+								Type:         schema.TypeFloat,
+								ValidateFunc: validateRolloutStep,
+							},
+						},
+
+						"health_url": &schema.Schema{
+							Type:     schema.TypeString,
+							Required: true,
+						},
+
+						"health_checks": &schema.Schema{
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      10,
+							ValidateFunc: validateHealthChecks,
+						},
+
+						"max_error_rate": &schema.Schema{
+							Type:     schema.TypeFloat,
+							Optional: true,
+							Default:  0.0,
+						},
+
+						"step_interval": &schema.Schema{
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "60s",
+							ValidateFunc: validateStepInterval,
+						},
+					},
+				},
+			},
+
+			"rollout_step": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			"version_url": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"module_url": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"create_time": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"created_by": &schema.Schema{
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+
+			"disk_usage_bytes": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			"instance_count": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
 		},
 	}
 }
@@ -102,6 +492,20 @@ var (
 	remoteBase = "https://storage.googleapis.com/"
 )
 
+// moduleURL is the appspot.com address that serves the module's traffic split
+func moduleURL(project, moduleName string) string {
+	if moduleName == "default" {
+		return "https://" + project + ".appspot.com"
+	}
+	return "https://" + moduleName + "-dot-" + project + ".appspot.com"
+}
+
+// versionURL is the appspot.com address that targets a single version
+// regardless of how traffic is split
+func versionURL(project, moduleName, versionId string) string {
+	return "https://" + versionId + "-dot-" + moduleName + "-dot-" + project + ".appspot.com"
+}
+
 
 func urlHandlers() ([]*appengine.UrlMap) {
 	handlers := make([]*appengine.UrlMap, 0)
@@ -144,33 +548,69 @@ func urlHandlers() ([]*appengine.UrlMap) {
 
 // known issues with this function:
 //   assumes "/" is delimiter in gstorage and forces that to be last char in key
-//   only searches first page, if more then 1k files to load, will only grab first 1k
 func generateFileList(d *schema.ResourceData, config *Config) (map[string]appengine.FileInfo, error) {
-	listService := storage.NewObjectsService(config.clientStorage)
-	bucket := d.Get("gstorageBucket").(string)
-	listCall := listService.List(bucket)
-	key := d.Get("gstorageKey").(string)
-	lastChar := key[len(key)-1:]
-	if lastChar != "/" {
-		key = key + "/"
-	}
-	listCall = listCall.Prefix(key)
-	objs, err := listCall.Do()
+	bucket := d.Get("gstorage_bucket").(string)
+	key := normalizeKey(d.Get("gstorage_key").(string))
+	objs, _, err := listObjects(config, bucket, key, "")
 	if err != nil {
 		return nil, err
 	}
-	
+
+	return filesFromObjects(bucket, key, objs), nil
+}
+
+// normalizeKey forces "/" to be the last char of a gstorage key so that it
+// only matches objects inside that "directory"
+func normalizeKey(key string) string {
+	if key != "" && !strings.HasSuffix(key, "/") {
+		key = key + "/"
+	}
+	return key
+}
+
+// listObjects pages through every object under prefix.  When a delimiter is
+// given the "directories" directly under prefix are returned as well.
+func listObjects(config *Config, bucket, prefix, delimiter string) ([]*storage.Object, []string, error) {
+	listService := storage.NewObjectsService(config.clientStorage)
+	listCall := listService.List(bucket).Prefix(prefix)
+	if delimiter != "" {
+		listCall = listCall.Delimiter(delimiter)
+	}
+
+	objs := make([]*storage.Object, 0)
+	prefixes := make([]string, 0)
+	for {
+		resp, err := listCall.Do()
+		if err != nil {
+			return nil, nil, err
+		}
+		objs = append(objs, resp.Items...)
+		prefixes = append(prefixes, resp.Prefixes...)
+
+		if resp.NextPageToken == "" {
+			break
+		}
+		listCall = listCall.PageToken(resp.NextPageToken)
+	}
+
+	return objs, prefixes, nil
+}
+
+// filesFromObjects builds the deployment manifest, keyed on the file's path
+// relative to key
+func filesFromObjects(bucket, key string, objs []*storage.Object) map[string]appengine.FileInfo {
 	files := make(map[string]appengine.FileInfo)
-	for _, obj := range objs.Items {
-		onDiskName := strings.Replace(obj.Name, key, "", 1)  // trims key from file name
+	for _, obj := range objs {
+		onDiskName := strings.TrimPrefix(obj.Name, key) // trims key from file name
 		inCloudURL := remoteBase + bucket + "/" + obj.Name
-		files[onDiskName] = appengine.FileInfo{SourceUrl:inCloudURL} 
+		files[onDiskName] = appengine.FileInfo{SourceUrl: inCloudURL}
 	}
-	
-	return files, nil
+	return files
 }
 
 func renderAppengineXML(d  *schema.ResourceData, config *Config) (error) {
+	project := getProject(d, config)
+
 	type AppengineXmlData struct {
 		Project			string
 		SourceVersion	string
@@ -179,10 +619,10 @@ func renderAppengineXML(d  *schema.ResourceData, config *Config) (error) {
 	}
 	
 	axd := AppengineXmlData{
-		Project: config.Project,
+		Project: project,
 		SourceVersion: d.Get("version").(string),
-		Module: d.Get("moduleName").(string),
-		TopicName: d.Get("topicName").(string),
+		Module: d.Get("module_name").(string),
+		TopicName: d.Get("topic_name").(string),
 	}
 	
 	templ, err := template.New("appengine-web.xml.template").Parse(axdTemplate)
@@ -204,11 +644,7 @@ func renderAppengineXML(d  *schema.ResourceData, config *Config) (error) {
 }
 
 func pushAppengineXmlToCloud(d *schema.ResourceData, config *Config) (error) {
-	key := d.Get("gstorageKey").(string)
-	lastChar := key[len(key)-1:]
-	if lastChar != "/" {
-		key = key + "/"
-	}
+	key := normalizeKey(d.Get("gstorage_key").(string))
 	key = key + "WEB-INF/appengine-web.xml"
 	object := &storage.Object{Name: key}
     file, err := os.Open("appengine-web.xml")
@@ -216,7 +652,7 @@ func pushAppengineXmlToCloud(d *schema.ResourceData, config *Config) (error) {
     	fmt.Errorf("Error opening %q: %v", "appengine.xml", err)
     }
 	objectService := storage.NewObjectsService(config.clientStorage)
-	_, err = objectService.Insert(d.Get("gstorageBucket").(string), object).Media(file).Do()
+	_, err = objectService.Insert(d.Get("gstorage_bucket").(string), object).Media(file).Do()
     if err != nil {
         fmt.Errorf("Objects.Insert failed: %v", err)
     }
@@ -238,50 +674,367 @@ func renderAppengineXMLToCloud(d *schema.ResourceData, config *Config) (error) {
 	return nil
 }
 
-func validateLatency(latency string) (string, error) {
-	lastChar := latency[len(latency)-1:]
-	if lastChar != "s" {
-		return "", fmt.Errorf("latency values must be between 1 and 15 seconds in the form: 3s")
+// validateLatency accepts "automatic" or a duration such as 250ms or 1.5s
+// within the 0.01s to 15s range App Engine allows
+func validateLatency(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	if strings.EqualFold(value, "automatic") {
+		return
 	}
-	latency_i, err := strconv.Atoi(latency[:len(latency)-1])
+
+	latency, err := time.ParseDuration(value)
 	if err != nil {
-		return "", err
+		errors = append(errors, fmt.Errorf(
+			"%q must be \"automatic\" or a duration such as 250ms or 1.5s, got %q", k, value))
+		return
 	}
-	if latency_i < 1 || latency_i > 15 {
-		return "", fmt.Errorf("latency values must be between 1 and 15 seconds in the form: 3s")
+	if latency < 10*time.Millisecond || latency > 15*time.Second {
+		errors = append(errors, fmt.Errorf("%q must be between 0.01s and 15s, got %q", k, value))
 	}
-	
-	return latency, nil
+	return
 }
 
-func resourceAppengineCreate(d *schema.ResourceData, meta interface{}) error {
-	config := meta.(*Config)
+var secondsRegexp = regexp.MustCompile(`^\d+(\.\d+)?s$`)
 
+// validateSeconds accepts a duration in the seconds only form the API uses,
+// e.g. 5s or 1.5s
+func validateSeconds(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	if !secondsRegexp.MatchString(value) {
+		errors = append(errors, fmt.Errorf("%q must be a duration in seconds such as 5s or 1.5s, got %q", k, value))
+	}
+	return
+}
 
-	scaling_raw := d.Get("scaling").([]interface{})
-	if len(scaling_raw) > 1 {
-		return fmt.Errorf("User supplied more then one scaling setting.  This is wrong")
+// formatLatency converts a validated latency into the duration format the
+// API expects, e.g. 250ms becomes 0.25s.  "automatic" becomes an empty string
+// so that App Engine picks the latency itself.
+func formatLatency(value string) string {
+	if value == "" || strings.EqualFold(value, "automatic") {
+		return ""
 	}
-	
-	
-	scale := scaling_raw[0].(map[string]interface{})
-	minPendingLatency, err := validateLatency(scale["minPendingLatency"].(string))
+
+	latency, err := time.ParseDuration(value)
 	if err != nil {
-		return err
+		return value
 	}
-	
-	maxPendingLatency, err := validateLatency(scale["maxPendingLatency"].(string))
+	return strconv.FormatFloat(latency.Seconds(), 'f', -1, 64) + "s"
+}
+
+var inboundServices = []string{
+	"INBOUND_SERVICE_MAIL",
+	"INBOUND_SERVICE_MAIL_BOUNCE",
+	"INBOUND_SERVICE_XMPP_ERROR",
+	"INBOUND_SERVICE_XMPP_MESSAGE",
+	"INBOUND_SERVICE_XMPP_SUBSCRIBE",
+	"INBOUND_SERVICE_XMPP_PRESENCE",
+	"INBOUND_SERVICE_CHANNEL_PRESENCE",
+	"INBOUND_SERVICE_WARMUP",
+}
+
+func validateInboundService(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	for _, service := range inboundServices {
+		if value == service {
+			return
+		}
+	}
+	errors = append(errors, fmt.Errorf(
+		"%q must be one of %s, got %q", k, strings.Join(inboundServices, ", "), value))
+	return
+}
+
+var errorCodes = []string{"default", "over_quota", "dos_api_denial", "timeout"}
+
+func validateErrorCode(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	for _, code := range errorCodes {
+		if value == code {
+			return
+		}
+	}
+	errors = append(errors, fmt.Errorf(
+		"%q must be one of %s, got %q", k, strings.Join(errorCodes, ", "), value))
+	return
+}
+
+// only the F classes used with automatic scaling, the B classes need basic or
+// manual scaling which this resource cannot configure
+var instanceClasses = []string{
+	"F1", "F2", "F4", "F4_1G",
+}
+
+func validateInstanceClass(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	for _, class := range instanceClasses {
+		if value == class {
+			return
+		}
+	}
+	errors = append(errors, fmt.Errorf(
+		"%q must be one of %s, got %q", k, strings.Join(instanceClasses, ", "), value))
+	return
+}
+
+// deprecatedAttributes maps the snake_case attributes to the camelCase names
+// they replaced.  Both are accepted for one release; Create copies whichever
+// was configured onto the new name and Read keeps both up to date.
+var deprecatedAttributes = map[string]string{
+	"module_name":     "moduleName",
+	"gstorage_bucket": "gstorageBucket",
+	"gstorage_key":    "gstorageKey",
+	"topic_name":      "topicName",
+}
+
+// deprecatedScalingAttributes does the same for the attributes of the
+// scaling block.  Only the snake_case names are ever kept in state, see
+// setDeprecatedAttributes.
+var deprecatedScalingAttributes = map[string]string{
+	"min_idle_instances":  "minIdleInstances",
+	"max_idle_instances":  "maxIdleInstances",
+	"min_pending_latency": "minPendingLatency",
+	"max_pending_latency": "maxPendingLatency",
+}
+
+func setDeprecatedAttributes(d *schema.ResourceData) {
+	for newName, oldName := range deprecatedAttributes {
+		if d.Get(newName).(string) == "" {
+			d.Set(newName, d.Get(oldName).(string))
+		}
+	}
+
+	scaling := d.Get("scaling").([]interface{})
+	if len(scaling) == 0 || scaling[0] == nil {
+		return
+	}
+	raw := scaling[0].(map[string]interface{})
+	for newName, oldName := range deprecatedScalingAttributes {
+		if v := raw[oldName]; v != nil && v != 0 && v != "" {
+			raw[newName] = v
+		}
+		delete(raw, oldName)
+	}
+	d.Set("scaling", []interface{}{raw})
+}
+
+// suppressWhenAliasMatches ignores the default a snake_case scaling attribute
+// falls back to while the configuration sets its deprecated camelCase alias
+// to the value already in state
+func suppressWhenAliasMatches(alias string) schema.SchemaDiffSuppressFunc {
+	return func(k, old, new string, d *schema.ResourceData) bool {
+		v, ok := d.GetOk(k[:strings.LastIndex(k, ".")+1] + alias)
+		return ok && fmt.Sprint(v) == old
+	}
+}
+
+// suppressAliasMatches ignores a deprecated camelCase scaling attribute that
+// is unset or agrees with its snake_case replacement in state
+func suppressAliasMatches(name string) schema.SchemaDiffSuppressFunc {
+	return func(k, old, new string, d *schema.ResourceData) bool {
+		if new == "" || new == "0" {
+			return true
+		}
+		applied, _ := d.GetChange(k[:strings.LastIndex(k, ".")+1] + name)
+		return fmt.Sprint(applied) == new
+	}
+}
+
+// resourceAppengineCustomizeDiff catches combinations of settings that are
+// each valid on their own but which App Engine rejects together, so they fail
+// at plan time rather than after the deployment has been uploaded
+func resourceAppengineCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" {
+		for newName, oldName := range deprecatedAttributes {
+			if d.Get(newName).(string) == "" && d.Get(oldName).(string) == "" &&
+				d.NewValueKnown(newName) && d.NewValueKnown(oldName) {
+				return fmt.Errorf("%s is required", newName)
+			}
+		}
+	}
+
+	// promoting a stopped version would send all of the module's traffic to
+	// something that cannot serve it
+	if d.Get("serving_status").(string) == "STOPPED" && d.Get("promote").(bool) {
+		return fmt.Errorf("a version with serving_status STOPPED cannot be promoted, set promote = false or serving_status = SERVING")
+	}
+
+	if rollout := d.Get("rollout").([]interface{}); len(rollout) > 0 && rollout[0] != nil {
+		if !d.Get("promote").(bool) && d.NewValueKnown("promote") {
+			return fmt.Errorf("the rollout block only takes effect when the version is promoted, set promote = true")
+		}
+		if d.NewValueKnown("rollout.0.steps") {
+			steps := rollout[0].(map[string]interface{})["steps"].([]interface{})
+			if err := validateRolloutSteps(steps); err != nil {
+				return err
+			}
+		}
+	}
+
+	// flexible VM versions are sized with the resources block instead; the
+	// check is skipped for unchanged versions since Read fills instance_class
+	// in from the API
+	if d.Get("vm").(bool) && d.Get("instance_class").(string) != "" &&
+		(d.Id() == "" || d.HasChange("vm") || d.HasChange("instance_class")) {
+		return fmt.Errorf("instance_class is not supported on flexible VM versions, use the resources block to size them")
+	}
+
+	if !d.Get("vm").(bool) {
+		for _, k := range []string{"resources", "network", "health_check"} {
+			if len(d.Get(k).([]interface{})) > 0 {
+				return fmt.Errorf("the %s block is only supported on flexible VM versions, set vm = true to use it", k)
+			}
+		}
+	}
+
+	return nil
+}
+
+// appengineIdRegexp is the format shared by module names and version ids
+var appengineIdRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+func validateModuleName(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	if len(value) > 63 {
+		errors = append(errors, fmt.Errorf("%q must be at most 63 characters long, got %d", k, len(value)))
+	}
+	if !appengineIdRegexp.MatchString(value) {
+		errors = append(errors, fmt.Errorf(
+			"%q may only contain lowercase letters, digits and hyphens, and must not start or end with a hyphen, got %q", k, value))
+	}
+	// would make the module's appspot.com url ambiguous
+	if strings.Contains(value, "-dot-") {
+		errors = append(errors, fmt.Errorf("%q must not contain \"-dot-\", got %q", k, value))
+	}
+	return
+}
+
+var (
+	bucketNameRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]*[a-z0-9])?$`)
+	ipAddressRegexp  = regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+$`)
+)
+
+// validateBucketName checks the Cloud Storage bucket naming rules, see
+// https://cloud.google.com/storage/docs/naming
+func validateBucketName(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	maxLength := 63
+	if strings.Contains(value, ".") {
+		maxLength = 222
+		for _, component := range strings.Split(value, ".") {
+			if len(component) > 63 {
+				errors = append(errors, fmt.Errorf(
+					"%q dot separated components must be at most 63 characters long, got %q", k, component))
+			}
+		}
+	}
+	if len(value) < 3 || len(value) > maxLength {
+		errors = append(errors, fmt.Errorf("%q must be between 3 and %d characters long, got %q", k, maxLength, value))
+	}
+	if !bucketNameRegexp.MatchString(value) {
+		errors = append(errors, fmt.Errorf(
+			"%q may only contain lowercase letters, digits, dashes, underscores and dots, "+
+				"and must start and end with a letter or digit, got %q", k, value))
+	}
+	if ipAddressRegexp.MatchString(value) {
+		errors = append(errors, fmt.Errorf("%q must not be an IP address, got %q", k, value))
+	}
+	if strings.HasPrefix(value, "goog") || strings.Contains(value, "google") {
+		errors = append(errors, fmt.Errorf("%q must not start with \"goog\" or contain \"google\", got %q", k, value))
+	}
+	return
+}
+
+var topicNameRegexp = regexp.MustCompile(`^projects/[^/]+/topics/[A-Za-z][A-Za-z0-9\-_.~+%]{2,254}$`)
+
+func validateTopicName(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	if !topicNameRegexp.MatchString(value) {
+		errors = append(errors, fmt.Errorf(
+			"%q must be of the form projects/{project}/topics/{topic}, where the topic name is 3-255 characters "+
+				"starting with a letter, got %q", k, value))
+	} else if strings.HasPrefix(value[strings.LastIndex(value, "/")+1:], "goog") {
+		errors = append(errors, fmt.Errorf("%q topic name must not start with \"goog\", got %q", k, value))
+	}
+	return
+}
+
+func validateVersionId(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	if len(value) > 63 {
+		errors = append(errors, fmt.Errorf("%q must be at most 63 characters long, got %d", k, len(value)))
+	}
+	if !appengineIdRegexp.MatchString(value) {
+		errors = append(errors, fmt.Errorf(
+			"%q may only contain lowercase letters, digits and hyphens, and must not start or end with a hyphen, got %q", k, value))
+	}
+	if strings.HasPrefix(value, "ah-") {
+		errors = append(errors, fmt.Errorf("%q must not start with the reserved prefix \"ah-\", got %q", k, value))
+	}
+	if value == "default" || value == "latest" {
+		errors = append(errors, fmt.Errorf("%q must not be the reserved name %q", k, value))
+	}
+	return
+}
+
+// generateVersionId builds a version id from the time of deployment and a
+// hash of the files being deployed, e.g. 20160302t104500-3f2a9c1d
+func generateVersionId(d *schema.ResourceData, config *Config) (string, error) {
+	key := normalizeKey(d.Get("gstorage_key").(string))
+	objs, _, err := listObjects(config, d.Get("gstorage_bucket").(string), key, "")
 	if err != nil {
-		return err
+		return "", err
 	}
-	automaticScaling := &appengine.AutomaticScaling{
-		MinIdleInstances: int64(scale["minIdleInstances"].(int)),
-		MaxIdleInstances: int64(scale["maxIdleInstances"].(int)),
-		MinPendingLatency: minPendingLatency,
-		MaxPendingLatency: maxPendingLatency,
+
+	return versionIdFromManifest(time.Now(), key, objs), nil
+}
+
+func versionIdFromManifest(now time.Time, key string, objs []*storage.Object) string {
+	entries := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		name := strings.TrimPrefix(obj.Name, key)
+		// rendered by us for every deploy, so it says nothing about the build
+		if name == "WEB-INF/appengine-web.xml" {
+			continue
+		}
+		entries = append(entries, name+" "+obj.Md5Hash)
 	}
-	
-	err = renderAppengineXMLToCloud(d, config)
+	sort.Strings(entries)
+
+	hash := sha1.New()
+	for _, entry := range entries {
+		hash.Write([]byte(entry + "\n"))
+	}
+
+	return now.UTC().Format("20060102t150405") + "-" + hex.EncodeToString(hash.Sum(nil))[:8]
+}
+
+func validateServingStatus(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	if value != "SERVING" && value != "STOPPED" {
+		errors = append(errors, fmt.Errorf(
+			"%q must be one of SERVING or STOPPED, got %q", k, value))
+	}
+	return
+}
+
+func resourceAppengineCreate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	project := getProject(d, config)
+	d.Set("project", project)
+	setDeprecatedAttributes(d)
+
+	if d.Get("version").(string) == "" {
+		versionId, err := generateVersionId(d, config)
+		if err != nil {
+			return err
+		}
+		log.Printf("[INFO] Generated version id %s", versionId)
+		d.Set("version", versionId)
+	}
+
+	automaticScaling := expandAutomaticScaling(d.Get("scaling").([]interface{}))
+
+	err := renderAppengineXMLToCloud(d, config)
 	if err != nil {
 		return err
 	}
@@ -295,11 +1048,18 @@ func resourceAppengineCreate(d *schema.ResourceData, meta interface{}) error {
 	
 	handlers := urlHandlers()
 	
-	inbound_services := make([]string, 1)
-	inbound_services[0] = "INBOUND_SERVICE_WARMUP"
+	// warmup requests were always enabled before inbound_services could be
+	// configured, so keep that as the default
+	inbound_services := make([]string, 0)
+	for _, service := range d.Get("inbound_services").(*schema.Set).List() {
+		inbound_services = append(inbound_services, service.(string))
+	}
+	if len(inbound_services) == 0 {
+		inbound_services = append(inbound_services, "INBOUND_SERVICE_WARMUP")
+	}
 	
 	env_vars := make(map[string]string,2)
-	env_vars["OUTPUTPUBSUB"] = d.Get("topicName").(string)
+	env_vars["OUTPUTPUBSUB"] = d.Get("topic_name").(string)
 	env_vars["RETURNMESSAGEIDS"] = "true"
 	
 	//  Version object for this module 
@@ -309,82 +1069,433 @@ func resourceAppengineCreate(d *schema.ResourceData, meta interface{}) error {
 		Handlers: handlers, 
 		Id: d.Get("version").(string), 
 		Runtime: "java7",
-		//InstanceClass: "F2",  this is exploding.  not sure why
+		InstanceClass: d.Get("instance_class").(string),
+		Vm: d.Get("vm").(bool),
+		Resources: expandResources(d.Get("resources").([]interface{})),
+		Network: expandNetwork(d.Get("network").([]interface{})),
 		InboundServices: inbound_services,
 		EnvVariables: env_vars,
 		Threadsafe: true,
+		HealthCheck: expandHealthCheck(d.Get("health_check").([]interface{})),
+		Libraries: expandLibraries(d.Get("libraries").([]interface{})),
+		ErrorHandlers: expandErrorHandlers(d.Get("error_handlers").([]interface{})),
+		BetaSettings: expandBetaSettings(d.Get("beta_settings").(map[string]interface{})),
 	}
 	
 	//  create the application
-	moduleVersionService := appengine.NewAppsModulesVersionsService(config.clientAppengine)
-	createCall := moduleVersionService.Create(config.Project, d.Get("moduleName").(string), version)
+	moduleVersionService := appengine.NewAppsServicesVersionsService(config.clientAppengine)
+	createCall := moduleVersionService.Create(project, d.Get("module_name").(string), version)
 	operation, err := createCall.Do()
 	if err != nil {
 		return err
 	}
 	
-	err = operationWait(operation, config)
+	err = operationWait(operation, project, config)
 	if err != nil {
 		return err
 	}
-	
+
+	// the version exists from here on, so record it before any follow up
+	// call can fail and leave it orphaned
+	d.SetId("apps/" + project + "/services/" + d.Get("module_name").(string) + "/versions/" + d.Get("version").(string))
+
+	err = applyServingUpdates(d, config, servingUpdates(d, true))
+	if err != nil {
+		return err
+	}
+
+	return resourceAppengineRead(d, meta)
+}
+
+func resourceAppengineUpdate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+
+	err := applyServingUpdates(d, config, servingUpdates(d, false))
+	if err != nil {
+		return err
+	}
+
 	return resourceAppengineRead(d, meta)
 }
 
-func operationWait(operation *appengine.Operation, config *Config) (error) {
-	//  wait for the creation to complete
-	operationService := appengine.NewAppsOperationsService(config.clientAppengine)
-	operationGet := operationService.Get(config.Project, strings.Replace(operation.Name, "apps/"+config.Project+"/operations/", "", 1))
-	carryon := true
-	for carryon {
-		operation, err := operationGet.Do()
+// servingUpdates lists the attributes whose API calls are needed after a
+// create or update, in the order they have to be made: the version is started
+// before any traffic is sent to it
+func servingUpdates(d *schema.ResourceData, creating bool) []string {
+	updates := make([]string, 0, 2)
+
+	// new versions start out serving
+	if creating && d.Get("serving_status").(string) == "STOPPED" ||
+		!creating && d.HasChange("serving_status") {
+		updates = append(updates, "serving_status")
+	}
+
+	if d.Get("promote").(bool) && (creating || d.HasChange("promote")) {
+		updates = append(updates, "promote")
+	}
+
+	return updates
+}
+
+func applyServingUpdates(d *schema.ResourceData, config *Config, updates []string) error {
+	for _, update := range updates {
+		var err error
+		switch update {
+		case "serving_status":
+			err = updateServingStatus(d, config, d.Get("serving_status").(string))
+		case "promote":
+			err = promoteVersion(d, config)
+			// the split is back as it was, so leave promote for the next
+			// apply to retry rather than recording the version as promoted
+			if err != nil {
+				d.Set("promote", false)
+			}
+		}
 		if err != nil {
 			return err
 		}
-		carryon = !operation.Done
-		time.Sleep(10*time.Second)
 	}
-	
-	//   if it failed, explode
-	if operation.Error != nil {
-		log.Printf("[DEBUG] status list from bad operation: %q", operation.Error.Details)
-		return fmt.Errorf(operation.Error.Message)
-	}
-	
 	return nil
 }
 
+// updateServingStatus starts or stops the version without touching any of
+// its other settings
+func updateServingStatus(d *schema.ResourceData, config *Config, status string) error {
+	project := getProject(d, config)
+	moduleVersionService := appengine.NewAppsServicesVersionsService(config.clientAppengine)
+	version := &appengine.Version{ServingStatus: status}
+	patchCall := moduleVersionService.Patch(project, d.Get("module_name").(string), d.Get("version").(string), version)
+	operation, err := patchCall.UpdateMask("servingStatus").Do()
+	if err != nil {
+		return err
+	}
+
+	return operationWait(operation, project, config)
+}
+
+// promoteVersion moves all of the module's traffic onto this version, either
+// in one go or in steps when a rollout block is configured
+func promoteVersion(d *schema.ResourceData, config *Config) error {
+	if len(d.Get("rollout").([]interface{})) > 0 {
+		return rolloutVersion(d, config)
+	}
+
+	project := getProject(d, config)
+	allocations := map[string]float64{d.Get("version").(string): 1}
+	return updateTrafficSplit(config, project, d.Get("module_name").(string), allocations)
+}
+
+func updateTrafficSplit(config *Config, project, moduleName string, allocations map[string]float64) error {
+	return patchTrafficSplit(config, project, moduleName, &appengine.TrafficSplit{
+		Allocations: allocations,
+	})
+}
+
+func patchTrafficSplit(config *Config, project, moduleName string, split *appengine.TrafficSplit) error {
+	module := &appengine.Service{
+		Split: split,
+	}
+
+	moduleService := appengine.NewAppsServicesService(config.clientAppengine)
+	patchCall := moduleService.Patch(project, moduleName, module)
+	operation, err := patchCall.UpdateMask("split").Do()
+	if err != nil {
+		return err
+	}
+
+	return operationWait(operation, project, config)
+}
+
+//  wait for the operation to complete on the provider's shared poller
+func operationWait(operation *appengine.Operation, project string, config *Config) error {
+	return config.operationPoller.wait(operation, project)
+}
+
+// servingURL prefers the url the API reports, which knows about region
+// scoped *.r.appspot.com domains, over the one versionURL constructs
+func servingURL(project, moduleName string, version *appengine.Version) string {
+	if version.VersionUrl != "" {
+		return version.VersionUrl
+	}
+	return versionURL(project, moduleName, version.Id)
+}
+
 func resourceAppengineRead(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(*Config)
+	project := getProject(d, config)
 
-	moduleVersionService := appengine.NewAppsModulesVersionsService(config.clientAppengine)
-	getCall := moduleVersionService.Get(config.Project, d.Get("moduleName").(string), d.Get("version").(string))
-	version, err := getCall.Do()
+	moduleVersionService := appengine.NewAppsServicesVersionsService(config.clientAppengine)
+	getCall := moduleVersionService.Get(project, d.Get("module_name").(string), d.Get("version").(string))
+	version, err := getCall.View("FULL").Do()
 	if err != nil {
+		// deleted outside of terraform, e.g. by a googleappengine_version_retention
+		if isNotFound(err) {
+			log.Printf("[WARN] Version %s no longer exists, removing it from state", d.Id())
+			d.SetId("")
+			return nil
+		}
 		return err
 	}
 
 	d.SetId(version.Name)
+	d.Set("project", project)
+	d.Set("serving_status", version.ServingStatus)
 	d.Set("servingStatus", version.ServingStatus)
+	for newName, oldName := range deprecatedAttributes {
+		d.Set(oldName, d.Get(newName))
+	}
+	d.Set("inbound_services", version.InboundServices)
+	d.Set("instance_class", version.InstanceClass)
+	d.Set("vm", version.Vm)
+	d.Set("resources", flattenResources(version.Resources))
+	d.Set("network", flattenNetwork(version.Network))
+	d.Set("health_check", flattenHealthCheck(version.HealthCheck))
+	d.Set("libraries", flattenLibraries(version.Libraries))
+	d.Set("error_handlers", flattenErrorHandlers(version.ErrorHandlers))
+	d.Set("beta_settings", version.BetaSettings)
+
+	d.Set("version_url", servingURL(project, d.Get("module_name").(string), version))
+	d.Set("module_url", moduleURL(project, d.Get("module_name").(string)))
+	d.Set("create_time", version.CreateTime)
+	d.Set("created_by", version.CreatedBy)
+	d.Set("disk_usage_bytes", int(version.DiskUsageBytes))
+
+	// informational only, so a failure here must not fail the whole refresh
+	instanceCount, err := countInstances(config, project, d.Get("module_name").(string), version.Id)
+	if err != nil {
+		log.Printf("[WARN] Could not count the instances of version %s, leaving instance_count as it was: %s", d.Id(), err)
+	} else {
+		d.Set("instance_count", instanceCount)
+	}
 	return nil
 }
 
+// countInstances pages through the instances currently running the version
+func countInstances(config *Config, project, moduleName, versionId string) (int, error) {
+	instanceService := appengine.NewAppsServicesVersionsInstancesService(config.clientAppengine)
+	listCall := instanceService.List(project, moduleName, versionId)
+
+	count := 0
+	for {
+		resp, err := listCall.Do()
+		if err != nil {
+			return 0, err
+		}
+		count += len(resp.Instances)
+
+		if resp.NextPageToken == "" {
+			break
+		}
+		listCall = listCall.PageToken(resp.NextPageToken)
+	}
+
+	return count, nil
+}
+
+func expandLibraries(configured []interface{}) []*appengine.Library {
+	libraries := make([]*appengine.Library, 0, len(configured))
+	for _, raw := range configured {
+		library := raw.(map[string]interface{})
+		libraries = append(libraries, &appengine.Library{
+			Name:    library["name"].(string),
+			Version: library["version"].(string),
+		})
+	}
+	return libraries
+}
+
+func flattenLibraries(libraries []*appengine.Library) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(libraries))
+	for _, library := range libraries {
+		result = append(result, map[string]interface{}{
+			"name":    library.Name,
+			"version": library.Version,
+		})
+	}
+	return result
+}
+
+// error codes are configured without the ERROR_CODE_ prefix the API uses,
+// e.g. over_quota rather than ERROR_CODE_OVER_QUOTA
+func expandErrorHandlers(configured []interface{}) []*appengine.ErrorHandler {
+	handlers := make([]*appengine.ErrorHandler, 0, len(configured))
+	for _, raw := range configured {
+		handler := raw.(map[string]interface{})
+		handlers = append(handlers, &appengine.ErrorHandler{
+			ErrorCode:  "ERROR_CODE_" + strings.ToUpper(handler["error_code"].(string)),
+			StaticFile: handler["static_file"].(string),
+			MimeType:   handler["mime_type"].(string),
+		})
+	}
+	return handlers
+}
+
+func flattenErrorHandlers(handlers []*appengine.ErrorHandler) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(handlers))
+	for _, handler := range handlers {
+		errorCode := strings.ToLower(strings.TrimPrefix(handler.ErrorCode, "ERROR_CODE_"))
+		if errorCode == "" || errorCode == "unspecified" {
+			errorCode = "default"
+		}
+		result = append(result, map[string]interface{}{
+			"error_code":  errorCode,
+			"static_file": handler.StaticFile,
+			"mime_type":   handler.MimeType,
+		})
+	}
+	return result
+}
+
+func expandBetaSettings(configured map[string]interface{}) map[string]string {
+	settings := make(map[string]string, len(configured))
+	for k, v := range configured {
+		settings[k] = v.(string)
+	}
+	return settings
+}
+
+func expandResources(configured []interface{}) *appengine.Resources {
+	if len(configured) == 0 || configured[0] == nil {
+		return nil
+	}
+
+	raw := configured[0].(map[string]interface{})
+	return &appengine.Resources{
+		Cpu:      raw["cpu"].(float64),
+		MemoryGb: raw["memory_gb"].(float64),
+		DiskGb:   raw["disk_gb"].(float64),
+	}
+}
+
+func flattenResources(resources *appengine.Resources) []map[string]interface{} {
+	if resources == nil {
+		return nil
+	}
+
+	return []map[string]interface{}{
+		map[string]interface{}{
+			"cpu":       resources.Cpu,
+			"memory_gb": resources.MemoryGb,
+			"disk_gb":   resources.DiskGb,
+		},
+	}
+}
+
+func expandNetwork(configured []interface{}) *appengine.Network {
+	if len(configured) == 0 || configured[0] == nil {
+		return nil
+	}
+
+	raw := configured[0].(map[string]interface{})
+	ports := make([]string, 0)
+	for _, port := range raw["forwarded_ports"].([]interface{}) {
+		ports = append(ports, port.(string))
+	}
+
+	return &appengine.Network{
+		Name:           raw["name"].(string),
+		ForwardedPorts: ports,
+		InstanceTag:    raw["instance_tag"].(string),
+	}
+}
+
+func flattenNetwork(network *appengine.Network) []map[string]interface{} {
+	if network == nil {
+		return nil
+	}
+
+	return []map[string]interface{}{
+		map[string]interface{}{
+			"name":            network.Name,
+			"forwarded_ports": network.ForwardedPorts,
+			"instance_tag":    network.InstanceTag,
+		},
+	}
+}
+
+// expandAutomaticScaling returns nil when no scaling block is configured so
+// that App Engine applies its own defaults
+func expandAutomaticScaling(configured []interface{}) *appengine.AutomaticScaling {
+	if len(configured) == 0 || configured[0] == nil {
+		return nil
+	}
+
+	raw := configured[0].(map[string]interface{})
+	scaling := &appengine.AutomaticScaling{
+		MinIdleInstances:  int64(raw["min_idle_instances"].(int)),
+		MaxIdleInstances:  int64(raw["max_idle_instances"].(int)),
+		MinPendingLatency: formatLatency(raw["min_pending_latency"].(string)),
+		MaxPendingLatency: formatLatency(raw["max_pending_latency"].(string)),
+	}
+
+	// the deprecated camelCase names win when they are set, a zero value is
+	// indistinguishable from unset so that falls back to the new name
+	if v, ok := raw["minIdleInstances"].(int); ok && v != 0 {
+		scaling.MinIdleInstances = int64(v)
+	}
+	if v, ok := raw["maxIdleInstances"].(int); ok && v != 0 {
+		scaling.MaxIdleInstances = int64(v)
+	}
+	if v, ok := raw["minPendingLatency"].(string); ok && v != "" {
+		scaling.MinPendingLatency = formatLatency(v)
+	}
+	if v, ok := raw["maxPendingLatency"].(string); ok && v != "" {
+		scaling.MaxPendingLatency = formatLatency(v)
+	}
+
+	return scaling
+}
+
+func expandHealthCheck(configured []interface{}) *appengine.HealthCheck {
+	if len(configured) == 0 || configured[0] == nil {
+		return nil
+	}
+
+	raw := configured[0].(map[string]interface{})
+	return &appengine.HealthCheck{
+		CheckInterval:      raw["check_interval"].(string),
+		Timeout:            raw["timeout"].(string),
+		UnhealthyThreshold: int64(raw["unhealthy_threshold"].(int)),
+		HealthyThreshold:   int64(raw["healthy_threshold"].(int)),
+		RestartThreshold:   int64(raw["restart_threshold"].(int)),
+		DisableHealthCheck: raw["disable_health_check"].(bool),
+	}
+}
+
+func flattenHealthCheck(healthCheck *appengine.HealthCheck) []map[string]interface{} {
+	if healthCheck == nil {
+		return nil
+	}
+
+	return []map[string]interface{}{
+		map[string]interface{}{
+			"check_interval":       healthCheck.CheckInterval,
+			"timeout":              healthCheck.Timeout,
+			"unhealthy_threshold":  int(healthCheck.UnhealthyThreshold),
+			"healthy_threshold":    int(healthCheck.HealthyThreshold),
+			"restart_threshold":    int(healthCheck.RestartThreshold),
+			"disable_health_check": healthCheck.DisableHealthCheck,
+		},
+	}
+}
+
 func resourceAppengineDelete(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(*Config)
+	project := getProject(d, config)
 
-	moduleVersionService := appengine.NewAppsModulesVersionsService(config.clientAppengine)
-	deleteCall := moduleVersionService.Delete(config.Project, d.Get("moduleName").(string), d.Get("version").(string))
+	moduleVersionService := appengine.NewAppsServicesVersionsService(config.clientAppengine)
+	deleteCall := moduleVersionService.Delete(project, d.Get("module_name").(string), d.Get("version").(string))
 	operation, err := deleteCall.Do()
 	if err != nil {
-		if strings.Contains(err.Error(), "Cannot delete the final version of a service (module)") {
-			moduleService := appengine.NewAppsModulesService(config.clientAppengine)
-			moduleDelete := moduleService.Delete(config.Project, d.Get("moduleName").(string))
+		if strings.Contains(err.Error(), "Cannot delete the final version of a service") {
+			moduleService := appengine.NewAppsServicesService(config.clientAppengine)
+			moduleDelete := moduleService.Delete(project, d.Get("module_name").(string))
 			operation, err = moduleDelete.Do()
 			if err != nil {
 				return err
 			}
 			
-			err = operationWait(operation, config)
+			err = operationWait(operation, project, config)
 			if err != nil {
 				return err
 			}		
@@ -392,7 +1503,7 @@ func resourceAppengineDelete(d *schema.ResourceData, meta interface{}) error {
 			return err
 		}
 	} else {
-		err = operationWait(operation, config)
+		err = operationWait(operation, project, config)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func resourceAppengineMigrateState(
+	v int, is *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+	if is.Empty() {
+		log.Println("[DEBUG] Empty InstanceState; nothing to migrate.")
+		return is, nil
+	}
+
+	switch v {
+	case 0:
+		log.Println("[INFO] Found Appengine State v0; migrating to v1")
+		var err error
+		is, err = migrateAppengineStateV0toV1(is)
+		if err != nil {
+			return is, err
+		}
+		return migrateAppengineStateV1toV2(is)
+	case 1:
+		log.Println("[INFO] Found Appengine State v1; migrating to v2")
+		return migrateAppengineStateV1toV2(is)
+	default:
+		return is, fmt.Errorf("Unexpected schema version: %d", v)
+	}
+}
+
+// migrateAppengineStateV0toV1 copies the camelCase attributes onto their
+// snake_case replacements.  The old top level names are left in place since
+// Read keeps both up to date, but the scaling block's are renamed outright:
+// nothing refreshes them and a stale alias in state would mask later changes
+// to the new names.
+func migrateAppengineStateV0toV1(is *terraform.InstanceState) (*terraform.InstanceState, error) {
+	log.Printf("[DEBUG] Attributes before migration: %#v", is.Attributes)
+
+	renames := map[string]string{
+		"servingStatus": "serving_status",
+	}
+	for newName, oldName := range deprecatedAttributes {
+		renames[oldName] = newName
+	}
+
+	scalingRenames := make(map[string]string)
+	for newName, oldName := range deprecatedScalingAttributes {
+		scalingRenames[oldName] = newName
+	}
+
+	for k, v := range is.Attributes {
+		newName := renames[k]
+
+		// scaling.0.minIdleInstances
+		if parts := strings.Split(k, "."); len(parts) == 3 && parts[0] == "scaling" {
+			if renamed, ok := scalingRenames[parts[2]]; ok {
+				newName = parts[0] + "." + parts[1] + "." + renamed
+				delete(is.Attributes, k)
+			}
+		}
+
+		if newName == "" {
+			continue
+		}
+		if _, ok := is.Attributes[newName]; !ok {
+			is.Attributes[newName] = v
+		}
+	}
+
+	log.Printf("[DEBUG] Attributes after migration: %#v", is.Attributes)
+	return is, nil
+}
+
+// migrateAppengineStateV1toV2 rewrites ids from the v1beta4 API, where
+// services were called modules, onto the v1 API's naming
+func migrateAppengineStateV1toV2(is *terraform.InstanceState) (*terraform.InstanceState, error) {
+	log.Printf("[DEBUG] ID before migration: %s", is.ID)
+	is.ID = migrateModuleId(is.ID)
+	log.Printf("[DEBUG] ID after migration: %s", is.ID)
+	return is, nil
+}
+
+// migrateModuleId turns apps/{project}/modules/{module}/... into
+// apps/{project}/services/{module}/...
+func migrateModuleId(id string) string {
+	parts := strings.Split(id, "/")
+	if len(parts) > 2 && parts[0] == "apps" && parts[2] == "modules" {
+		parts[2] = "services"
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAppengineMigrateState(t *testing.T) {
+	cases := map[string]struct {
+		StateVersion int
+		Attributes   map[string]string
+		Expected     map[string]string
+		Removed      []string
+	}{
+		"v0 camelCase attributes": {
+			StateVersion: 0,
+			Attributes: map[string]string{
+				"moduleName":                  "foobar",
+				"version":                     "foobaz",
+				"gstorageBucket":              "build-artifacts-public-eu",
+				"gstorageKey":                 "hxtest-1.0-SNAPSHOT/",
+				"topicName":                   "projects/hx-test/topics/notarealtopic",
+				"servingStatus":               "SERVING",
+				"scaling.#":                   "1",
+				"scaling.0.minIdleInstances":  "1",
+				"scaling.0.maxIdleInstances":  "3",
+				"scaling.0.minPendingLatency": "1s",
+				"scaling.0.maxPendingLatency": "10s",
+			},
+			Expected: map[string]string{
+				"module_name":                   "foobar",
+				"moduleName":                    "foobar",
+				"version":                       "foobaz",
+				"gstorage_bucket":               "build-artifacts-public-eu",
+				"gstorage_key":                  "hxtest-1.0-SNAPSHOT/",
+				"topic_name":                    "projects/hx-test/topics/notarealtopic",
+				"serving_status":                "SERVING",
+				"servingStatus":                 "SERVING",
+				"scaling.#":                     "1",
+				"scaling.0.min_idle_instances":  "1",
+				"scaling.0.max_idle_instances":  "3",
+				"scaling.0.min_pending_latency": "1s",
+				"scaling.0.max_pending_latency": "10s",
+			},
+			Removed: []string{
+				"scaling.0.minIdleInstances",
+				"scaling.0.maxIdleInstances",
+				"scaling.0.minPendingLatency",
+				"scaling.0.maxPendingLatency",
+			},
+		},
+		"v1 module id": {
+			StateVersion: 1,
+			Attributes: map[string]string{
+				"module_name": "foobar",
+			},
+			Expected: map[string]string{
+				"module_name": "foobar",
+			},
+		},
+		"v0 serving_status already set": {
+			StateVersion: 0,
+			Attributes: map[string]string{
+				"moduleName":     "foobar",
+				"servingStatus":  "SERVING",
+				"serving_status": "STOPPED",
+			},
+			Expected: map[string]string{
+				"module_name":    "foobar",
+				"serving_status": "STOPPED",
+			},
+		},
+	}
+
+	for tn, tc := range cases {
+		is := &terraform.InstanceState{
+			ID:         "apps/hx-test/modules/foobar/versions/foobaz",
+			Attributes: tc.Attributes,
+		}
+		is, err := resourceAppengineMigrateState(tc.StateVersion, is, nil)
+		if err != nil {
+			t.Fatalf("bad: %s, err: %#v", tn, err)
+		}
+
+		if is.ID != "apps/hx-test/services/foobar/versions/foobaz" {
+			t.Fatalf("bad: %s, unexpected ID %s", tn, is.ID)
+		}
+
+		for k, v := range tc.Expected {
+			if is.Attributes[k] != v {
+				t.Fatalf(
+					"bad: %s\n\n expected: %#v -> %#v\n got: %#v -> %#v\n in: %#v",
+					tn, k, v, k, is.Attributes[k], is.Attributes)
+			}
+		}
+
+		for _, k := range tc.Removed {
+			if _, ok := is.Attributes[k]; ok {
+				t.Fatalf("bad: %s, expected %s to be removed, got: %#v", tn, k, is.Attributes)
+			}
+		}
+	}
+}
+
+func TestAppengineMigrateState_empty(t *testing.T) {
+	var is *terraform.InstanceState
+	var meta interface{}
+
+	// should handle nil
+	is, err := resourceAppengineMigrateState(0, is, meta)
+	if err != nil {
+		t.Fatalf("err: %#v", err)
+	}
+	if is != nil {
+		t.Fatalf("expected nil instancestate, got: %#v", is)
+	}
+
+	// should handle non-nil but empty
+	is = &terraform.InstanceState{}
+	is, err = resourceAppengineMigrateState(0, is, meta)
+	if err != nil {
+		t.Fatalf("err: %#v", err)
+	}
+}
+
+func TestMigrateModuleId(t *testing.T) {
+	cases := map[string]string{
+		"apps/hx-test/modules/foobar/versions/foobaz":  "apps/hx-test/services/foobar/versions/foobaz",
+		"apps/hx-test/services/foobar/versions/foobaz": "apps/hx-test/services/foobar/versions/foobaz",
+		"apps/modules/services/foobar/versions/foobaz": "apps/modules/services/foobar/versions/foobaz",
+	}
+
+	for id, expected := range cases {
+		if actual := migrateModuleId(id); actual != expected {
+			t.Fatalf("%q: expected %q, got %q", id, expected, actual)
+		}
+	}
+}
+
+// once migrated the scaling block is planned on the snake_case names alone:
+// changing them replaces the version, while leaving the values as they were,
+// under either name, plans nothing
+func TestAppengineMigrateState_scalingDiff(t *testing.T) {
+	cases := map[string]struct {
+		Scaling     map[string]interface{}
+		RequiresNew bool
+	}{
+		"changed min_idle_instances": {
+			Scaling: map[string]interface{}{
+				"min_idle_instances":  5,
+				"max_idle_instances":  3,
+				"min_pending_latency": "1s",
+				"max_pending_latency": "10s",
+			},
+			RequiresNew: true,
+		},
+		"unchanged": {
+			Scaling: map[string]interface{}{
+				"min_idle_instances":  2,
+				"max_idle_instances":  3,
+				"min_pending_latency": "1s",
+				"max_pending_latency": "10s",
+			},
+			RequiresNew: false,
+		},
+		"unchanged camelCase": {
+			Scaling: map[string]interface{}{
+				"minIdleInstances":  2,
+				"maxIdleInstances":  3,
+				"minPendingLatency": "1s",
+				"maxPendingLatency": "10s",
+			},
+			RequiresNew: false,
+		},
+	}
+
+	for tn, tc := range cases {
+		is := &terraform.InstanceState{
+			ID: "apps/hx-test/modules/foobar/versions/foobaz",
+			Attributes: map[string]string{
+				"moduleName":                  "foobar",
+				"version":                     "foobaz",
+				"gstorageBucket":              "build-artifacts-public-eu",
+				"gstorageKey":                 "hxtest-1.0-SNAPSHOT/",
+				"topicName":                   "projects/hx-test/topics/notarealtopic",
+				"servingStatus":               "SERVING",
+				"vm":                          "false",
+				"scaling.#":                   "1",
+				"scaling.0.minIdleInstances":  "2",
+				"scaling.0.maxIdleInstances":  "3",
+				"scaling.0.minPendingLatency": "1s",
+				"scaling.0.maxPendingLatency": "10s",
+			},
+		}
+		is, err := resourceAppengineMigrateState(0, is, nil)
+		if err != nil {
+			t.Fatalf("bad: %s, err: %#v", tn, err)
+		}
+
+		c := terraform.NewResourceConfigRaw(map[string]interface{}{
+			"module_name":     "foobar",
+			"version":         "foobaz",
+			"gstorage_bucket": "build-artifacts-public-eu",
+			"gstorage_key":    "hxtest-1.0-SNAPSHOT/",
+			"topic_name":      "projects/hx-test/topics/notarealtopic",
+			"scaling":         []interface{}{tc.Scaling},
+		})
+		diff, err := resourceAppengine().Diff(is, c, nil)
+		if err != nil {
+			t.Fatalf("bad: %s, err: %#v", tn, err)
+		}
+
+		if requiresNew := diff != nil && diff.RequiresNew(); requiresNew != tc.RequiresNew {
+			t.Fatalf("bad: %s, expected RequiresNew %t, got diff: %#v", tn, tc.RequiresNew, diff)
+		}
+		if tc.RequiresNew {
+			attr := diff.Attributes["scaling.0.min_idle_instances"]
+			if attr == nil || attr.Old != "2" || attr.New != "5" {
+				t.Fatalf("bad: %s, expected min_idle_instances to change from 2 to 5, got: %#v", tn, attr)
+			}
+		}
+	}
+}
@@ -1,11 +1,21 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/storage/v1"
 )
 
 func TestAccAppengineCreate(t *testing.T) {
@@ -19,6 +29,8 @@ func TestAccAppengineCreate(t *testing.T) {
 				Config: testAccAppengine,
 				Check: resource.ComposeTestCheckFunc(
 					testAccAppengineExists("googleappengine_app.foobar"),
+					resource.TestCheckResourceAttrSet("googleappengine_app.foobar", "version_url"),
+					resource.TestCheckResourceAttrSet("googleappengine_app.foobar", "create_time"),
 				),
 			},
 		},
@@ -32,7 +44,7 @@ func testAccCheckAppengineDestroy(s *terraform.State) error {
 		}
 
 		config := testAccProvider.Meta().(*Config)
-		_, err := config.clientAppengine.Apps.Modules.Versions.Get(config.Project, rs.Primary.Attributes["moduleName"], rs.Primary.Attributes["version"]).Do()
+		_, err := config.clientAppengine.Apps.Services.Versions.Get(config.Project, rs.Primary.Attributes["module_name"], rs.Primary.Attributes["version"]).Do()
 		if err != nil {
 			fmt.Errorf("Application still present")
 		}
@@ -52,7 +64,7 @@ func testAccAppengineExists(n string) resource.TestCheckFunc {
 			return fmt.Errorf("No ID is set")
 		}
 		config := testAccProvider.Meta().(*Config)
-		_, err := config.clientAppengine.Apps.Modules.Versions.Get(config.Project, rs.Primary.Attributes["moduleName"], rs.Primary.Attributes["version"]).Do()
+		_, err := config.clientAppengine.Apps.Services.Versions.Get(config.Project, rs.Primary.Attributes["module_name"], rs.Primary.Attributes["version"]).Do()
 		if err != nil {
 			fmt.Errorf("Application not present")
 		}
@@ -63,17 +75,631 @@ func testAccAppengineExists(n string) resource.TestCheckFunc {
 
 const testAccAppengine = `
 resource "googleappengine_app" "foobar" {
-	moduleName = "foobar"
+	module_name = "foobar"
 	version = "foobaz"
-	gstorageBucket = "build-artifacts-public-eu"
-	gstorageKey = "hxtest-1.0-SNAPSHOT/"
-	
+	gstorage_bucket = "build-artifacts-public-eu"
+	gstorage_key = "hxtest-1.0-SNAPSHOT/"
+
 	scaling {
-		minIdleInstances = 1
-		maxIdleInstances = 3
-		minPendingLatency = "1s"
-		maxPendingLatency = "10s"
+		min_idle_instances = 1
+		max_idle_instances = 3
+		min_pending_latency = "1s"
+		max_pending_latency = "10s"
 	}
-	
-	topicName = "projects/hx-test/topics/notarealtopic"
+
+	topic_name = "projects/hx-test/topics/notarealtopic"
 }`
+
+func TestValidateServingStatus(t *testing.T) {
+	cases := map[string]bool{
+		"SERVING": false,
+		"STOPPED": false,
+		"serving": true,
+		"":        true,
+	}
+
+	for value, expectErr := range cases {
+		_, errors := validateServingStatus(value, "serving_status")
+		if (len(errors) > 0) != expectErr {
+			t.Fatalf("%q: expected error %t, got %v", value, expectErr, errors)
+		}
+	}
+}
+
+func TestServingUpdates(t *testing.T) {
+	cases := []struct {
+		raw      map[string]interface{}
+		creating bool
+		expected []string
+	}{
+		{
+			raw:      map[string]interface{}{},
+			creating: true,
+			expected: []string{},
+		},
+		{
+			raw:      map[string]interface{}{"serving_status": "STOPPED"},
+			creating: true,
+			expected: []string{"serving_status"},
+		},
+		{
+			raw:      map[string]interface{}{"serving_status": "SERVING", "promote": true},
+			creating: true,
+			expected: []string{"promote"},
+		},
+		// starting a stopped version and promoting it in one apply
+		{
+			raw:      map[string]interface{}{"serving_status": "SERVING", "promote": true},
+			creating: false,
+			expected: []string{"serving_status", "promote"},
+		},
+		{
+			raw:      map[string]interface{}{"promote": false},
+			creating: false,
+			expected: []string{},
+		},
+	}
+
+	for i, tc := range cases {
+		d := schema.TestResourceDataRaw(t, resourceAppengine().Schema, tc.raw)
+		actual := servingUpdates(d, tc.creating)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("case %d: expected %v, got %v", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestAppengineCustomizeDiff_stoppedPromote(t *testing.T) {
+	c := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"module_name":     "foobar",
+		"version":         "foobaz",
+		"gstorage_bucket": "build-artifacts-public-eu",
+		"gstorage_key":    "hxtest-1.0-SNAPSHOT/",
+		"topic_name":      "projects/hx-test/topics/notarealtopic",
+		"serving_status":  "STOPPED",
+		"promote":         true,
+	})
+
+	_, err := resourceAppengine().Diff(nil, c, nil)
+	if err == nil || !strings.Contains(err.Error(), "cannot be promoted") {
+		t.Fatalf("expected a stopped version to be rejected for promotion, got %v", err)
+	}
+}
+
+// a version deleted outside of terraform, e.g. by a retention policy, drops
+// out of state rather than failing every refresh
+func TestAppengineRead_deleted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/apps/my-project/services/foobar/versions/foobaz" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"code": 404, "message": "Version not found: foobaz", "status": "NOT_FOUND"}}`))
+	}))
+	defer server.Close()
+
+	config := &Config{
+		AccessToken:       "fake-token",
+		Project:           "my-project",
+		AppengineEndpoint: server.URL,
+		StorageEndpoint:   server.URL,
+	}
+	if err := config.loadAndValidate(); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceAppengine().Schema, map[string]interface{}{
+		"module_name": "foobar",
+		"version":     "foobaz",
+	})
+	d.SetId("apps/my-project/services/foobar/versions/foobaz")
+
+	if err := resourceAppengineRead(d, config); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if d.Id() != "" {
+		t.Fatalf("expected the deleted version to be removed from state, got id %q", d.Id())
+	}
+}
+
+// instance_count is informational, failing to list the instances leaves the
+// rest of the refresh intact
+func TestAppengineRead_instancesUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/apps/my-project/services/foobar/versions/foobaz":
+			json.NewEncoder(w).Encode(&appengine.Version{
+				Name:          "apps/my-project/services/foobar/versions/foobaz",
+				Id:            "foobaz",
+				ServingStatus: "SERVING",
+			})
+		case "/v1/apps/my-project/services/foobar/versions/foobaz/instances":
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": {"code": 429, "message": "Quota exceeded", "status": "RESOURCE_EXHAUSTED"}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := &Config{
+		AccessToken:       "fake-token",
+		Project:           "my-project",
+		AppengineEndpoint: server.URL,
+		StorageEndpoint:   server.URL,
+	}
+	if err := config.loadAndValidate(); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceAppengine().Schema, map[string]interface{}{
+		"module_name": "foobar",
+		"version":     "foobaz",
+	})
+	d.SetId("apps/my-project/services/foobar/versions/foobaz")
+
+	if err := resourceAppengineRead(d, config); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if d.Get("serving_status").(string) != "SERVING" {
+		t.Fatalf("expected the rest of the version to be read, got serving_status %q", d.Get("serving_status"))
+	}
+}
+
+func TestHealthCheckRoundTrip(t *testing.T) {
+	configured := []interface{}{
+		map[string]interface{}{
+			"check_interval":       "5s",
+			"timeout":              "4s",
+			"unhealthy_threshold":  2,
+			"healthy_threshold":    2,
+			"restart_threshold":    60,
+			"disable_health_check": false,
+		},
+	}
+
+	flattened := flattenHealthCheck(expandHealthCheck(configured))
+	if len(flattened) != 1 {
+		t.Fatalf("expected one health_check block, got %v", flattened)
+	}
+	for k, v := range configured[0].(map[string]interface{}) {
+		if flattened[0][k] != v {
+			t.Fatalf("%s: expected %v, got %v", k, v, flattened[0][k])
+		}
+	}
+
+	if expandHealthCheck(nil) != nil {
+		t.Fatalf("expected no health check when the block is absent")
+	}
+}
+
+func TestValidateInstanceClass(t *testing.T) {
+	cases := map[string]bool{
+		"F1":    false,
+		"F4_1G": false,
+		"B8":    true,
+		"B3":    true,
+		"f1":    true,
+		"":      true,
+	}
+
+	for value, expectErr := range cases {
+		_, errors := validateInstanceClass(value, "instance_class")
+		if (len(errors) > 0) != expectErr {
+			t.Fatalf("%q: expected error %t, got %v", value, expectErr, errors)
+		}
+	}
+}
+
+func TestAppengineCustomizeDiff_rollout(t *testing.T) {
+	cases := []struct {
+		promote   bool
+		steps     []interface{}
+		expectErr string
+	}{
+		{true, []interface{}{10.0, 50.0, 100.0}, ""},
+		{false, []interface{}{10.0, 50.0, 100.0}, "set promote = true"},
+		{true, []interface{}{1.0, 10.0}, "must end at 100"},
+		{true, []interface{}{50.0, 10.0, 100.0}, "strictly increasing"},
+	}
+
+	for _, tc := range cases {
+		c := terraform.NewResourceConfigRaw(map[string]interface{}{
+			"module_name":     "foobar",
+			"version":         "foobaz",
+			"gstorage_bucket": "build-artifacts-public-eu",
+			"gstorage_key":    "hxtest-1.0-SNAPSHOT/",
+			"topic_name":      "projects/hx-test/topics/notarealtopic",
+			"promote":         tc.promote,
+			"rollout": []interface{}{
+				map[string]interface{}{
+					"steps":      tc.steps,
+					"health_url": "https://foobaz-dot-foobar-dot-hx-test.appspot.com/health",
+				},
+			},
+		})
+
+		_, err := resourceAppengine().Diff(nil, c, nil)
+		if tc.expectErr == "" && err != nil {
+			t.Fatalf("%v: unexpected error: %s", tc.steps, err)
+		}
+		if tc.expectErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectErr)) {
+			t.Fatalf("%v with promote %t: expected error containing %q, got %v", tc.steps, tc.promote, tc.expectErr, err)
+		}
+	}
+}
+
+func TestAppengineCustomizeDiff_healthCheck(t *testing.T) {
+	cases := map[bool]bool{
+		true:  false,
+		false: true,
+	}
+
+	for vm, expectErr := range cases {
+		c := terraform.NewResourceConfigRaw(map[string]interface{}{
+			"module_name":     "foobar",
+			"version":         "foobaz",
+			"gstorage_bucket": "build-artifacts-public-eu",
+			"gstorage_key":    "hxtest-1.0-SNAPSHOT/",
+			"topic_name":      "projects/hx-test/topics/notarealtopic",
+			"vm":              vm,
+			"health_check": []interface{}{
+				map[string]interface{}{
+					"check_interval": "5s",
+					"timeout":        "4s",
+				},
+			},
+		})
+
+		_, err := resourceAppengine().Diff(nil, c, nil)
+		if (err != nil) != expectErr {
+			t.Fatalf("vm %t: expected error %t, got %v", vm, expectErr, err)
+		}
+	}
+}
+
+func TestAppengineCustomizeDiff_vmInstanceClass(t *testing.T) {
+	cases := map[bool]bool{
+		false: false,
+		true:  true,
+	}
+
+	for vm, expectErr := range cases {
+		c := terraform.NewResourceConfigRaw(map[string]interface{}{
+			"module_name":     "foobar",
+			"version":         "foobaz",
+			"gstorage_bucket": "build-artifacts-public-eu",
+			"gstorage_key":    "hxtest-1.0-SNAPSHOT/",
+			"topic_name":      "projects/hx-test/topics/notarealtopic",
+			"instance_class":  "F2",
+			"vm":              vm,
+		})
+
+		_, err := resourceAppengine().Diff(nil, c, nil)
+		if (err != nil) != expectErr {
+			t.Fatalf("vm %t: expected error %t, got %v", vm, expectErr, err)
+		}
+	}
+}
+
+func TestValidateInboundService(t *testing.T) {
+	cases := map[string]bool{
+		"INBOUND_SERVICE_MAIL":             false,
+		"INBOUND_SERVICE_MAIL_BOUNCE":      false,
+		"INBOUND_SERVICE_CHANNEL_PRESENCE": false,
+		"INBOUND_SERVICE_WARMUP":           false,
+		"INBOUND_SERVICE_UNSPECIFIED":      true,
+		"mail":                             true,
+	}
+
+	for value, expectErr := range cases {
+		_, errors := validateInboundService(value, "inbound_services")
+		if (len(errors) > 0) != expectErr {
+			t.Fatalf("%q: expected error %t, got %v", value, expectErr, errors)
+		}
+	}
+}
+
+func TestErrorHandlersRoundTrip(t *testing.T) {
+	configured := []interface{}{
+		map[string]interface{}{
+			"error_code":  "over_quota",
+			"static_file": "over_quota.html",
+			"mime_type":   "text/html",
+		},
+		map[string]interface{}{
+			"error_code":  "default",
+			"static_file": "error.html",
+			"mime_type":   "",
+		},
+	}
+
+	expanded := expandErrorHandlers(configured)
+	if expanded[0].ErrorCode != "ERROR_CODE_OVER_QUOTA" {
+		t.Fatalf("expected ERROR_CODE_OVER_QUOTA, got %s", expanded[0].ErrorCode)
+	}
+
+	flattened := flattenErrorHandlers(expanded)
+	for i, raw := range configured {
+		for k, v := range raw.(map[string]interface{}) {
+			if flattened[i][k] != v {
+				t.Fatalf("handler %d %s: expected %v, got %v", i, k, v, flattened[i][k])
+			}
+		}
+	}
+}
+
+func TestVersionIdFromManifest(t *testing.T) {
+	now := time.Date(2016, 3, 2, 10, 45, 0, 0, time.UTC)
+	objs := []*storage.Object{
+		&storage.Object{Name: "build/WEB-INF/web.xml", Md5Hash: "abc"},
+		&storage.Object{Name: "build/index.html", Md5Hash: "def"},
+	}
+
+	versionId := versionIdFromManifest(now, "build/", objs)
+	if !regexp.MustCompile(`^20160302t104500-[0-9a-f]{8}$`).MatchString(versionId) {
+		t.Fatalf("unexpected version id %q", versionId)
+	}
+	if _, errors := validateVersionId(versionId, "version"); len(errors) > 0 {
+		t.Fatalf("generated version id %q is invalid: %v", versionId, errors)
+	}
+
+	// the rendered appengine-web.xml and listing order must not matter
+	reordered := []*storage.Object{
+		objs[1],
+		&storage.Object{Name: "build/WEB-INF/appengine-web.xml", Md5Hash: "xyz"},
+		objs[0],
+	}
+	if other := versionIdFromManifest(now, "build/", reordered); other != versionId {
+		t.Fatalf("expected %q, got %q", versionId, other)
+	}
+
+	changed := []*storage.Object{objs[0], &storage.Object{Name: "build/index.html", Md5Hash: "123"}}
+	if other := versionIdFromManifest(now, "build/", changed); other == versionId {
+		t.Fatalf("expected a different id when a file changes")
+	}
+}
+
+func TestValidateModuleName(t *testing.T) {
+	cases := []struct {
+		value     string
+		expectErr bool
+	}{
+		{"default", false},
+		{"foobar", false},
+		{"foo-bar-2", false},
+		{"Foobar", true},
+		{"-foobar", true},
+		{"foobar-", true},
+		{"foo_bar", true},
+		{"foo-dot-bar", true},
+		{"", true},
+		{strings.Repeat("a", 63), false},
+		{strings.Repeat("a", 64), true},
+	}
+
+	for _, tc := range cases {
+		_, errors := validateModuleName(tc.value, "module_name")
+		if (len(errors) > 0) != tc.expectErr {
+			t.Fatalf("%q: expected error %t, got %v", tc.value, tc.expectErr, errors)
+		}
+	}
+}
+
+func TestValidateVersionId(t *testing.T) {
+	cases := []struct {
+		value     string
+		expectErr bool
+	}{
+		{"foobaz", false},
+		{"20160302t104500-3f2a9c1d", false},
+		{"1-0-snapshot", false},
+		{"1.0", true},
+		{"FooBaz", true},
+		{"ah-builtin", true},
+		{"default", true},
+		{"latest", true},
+		{"foobaz-", true},
+		{strings.Repeat("a", 63), false},
+		{strings.Repeat("a", 64), true},
+	}
+
+	for _, tc := range cases {
+		_, errors := validateVersionId(tc.value, "version")
+		if (len(errors) > 0) != tc.expectErr {
+			t.Fatalf("%q: expected error %t, got %v", tc.value, tc.expectErr, errors)
+		}
+	}
+}
+
+func TestValidateBucketName(t *testing.T) {
+	cases := []struct {
+		value     string
+		expectErr bool
+	}{
+		{"build-artifacts-public-eu", false},
+		{"my_bucket.example.com", false},
+		{"ab", true},
+		{"Build-Artifacts", true},
+		{"-artifacts", true},
+		{"artifacts.", true},
+		{"192.168.5.4", true},
+		{"goog-artifacts", true},
+		{"my-google-artifacts", true},
+		{strings.Repeat("a", 63), false},
+		{strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 63) + "." + strings.Repeat("b", 63), false},
+		{strings.Repeat("a", 64) + ".example.com", true},
+	}
+
+	for _, tc := range cases {
+		_, errors := validateBucketName(tc.value, "gstorage_bucket")
+		if (len(errors) > 0) != tc.expectErr {
+			t.Fatalf("%q: expected error %t, got %v", tc.value, tc.expectErr, errors)
+		}
+	}
+}
+
+func TestValidateTopicName(t *testing.T) {
+	cases := []struct {
+		value     string
+		expectErr bool
+	}{
+		{"projects/hx-test/topics/notarealtopic", false},
+		{"projects/hx-test/topics/my.topic~name+1%", false},
+		{"notarealtopic", true},
+		{"projects/hx-test/topics/", true},
+		{"projects/hx-test/topics/ab", true},
+		{"projects/hx-test/topics/1topic", true},
+		{"projects/hx-test/topics/googtopic", true},
+		{"projects/hx-test/subscriptions/notarealtopic", true},
+		{"projects//topics/notarealtopic", true},
+	}
+
+	for _, tc := range cases {
+		_, errors := validateTopicName(tc.value, "topic_name")
+		if (len(errors) > 0) != tc.expectErr {
+			t.Fatalf("%q: expected error %t, got %v", tc.value, tc.expectErr, errors)
+		}
+	}
+}
+
+func TestValidateLatency(t *testing.T) {
+	cases := []struct {
+		value     string
+		expectErr bool
+	}{
+		{"Automatic", false},
+		{"automatic", false},
+		{"250ms", false},
+		{"1.5s", false},
+		{"10ms", false},
+		{"15s", false},
+		{"1s", false},
+		{"5ms", true},
+		{"16s", true},
+		{"3", true},
+		{"", true},
+	}
+
+	for _, tc := range cases {
+		_, errors := validateLatency(tc.value, "min_pending_latency")
+		if (len(errors) > 0) != tc.expectErr {
+			t.Fatalf("%q: expected error %t, got %v", tc.value, tc.expectErr, errors)
+		}
+	}
+}
+
+func TestValidateSeconds(t *testing.T) {
+	cases := map[string]bool{
+		"5s":   false,
+		"1.5s": false,
+		"300s": false,
+		"5m":   true,
+		"5":    true,
+		"s":    true,
+		"":     true,
+	}
+
+	for value, expectErr := range cases {
+		_, errors := validateSeconds(value, "check_interval")
+		if (len(errors) > 0) != expectErr {
+			t.Fatalf("%q: expected error %t, got %v", value, expectErr, errors)
+		}
+	}
+}
+
+func TestFormatLatency(t *testing.T) {
+	cases := map[string]string{
+		"Automatic": "",
+		"250ms":     "0.25s",
+		"1.5s":      "1.5s",
+		"10s":       "10s",
+	}
+
+	for value, expected := range cases {
+		if actual := formatLatency(value); actual != expected {
+			t.Fatalf("%q: expected %q, got %q", value, expected, actual)
+		}
+	}
+}
+
+func TestExpandAutomaticScaling(t *testing.T) {
+	cases := []struct {
+		raw      map[string]interface{}
+		expected *appengine.AutomaticScaling
+	}{
+		{
+			raw:      map[string]interface{}{},
+			expected: nil,
+		},
+		{
+			raw: map[string]interface{}{
+				"scaling": []interface{}{
+					map[string]interface{}{},
+				},
+			},
+			expected: &appengine.AutomaticScaling{
+				MinIdleInstances: 1,
+				MaxIdleInstances: 3,
+			},
+		},
+		{
+			raw: map[string]interface{}{
+				"scaling": []interface{}{
+					map[string]interface{}{
+						"min_idle_instances": 2,
+					},
+				},
+			},
+			expected: &appengine.AutomaticScaling{
+				MinIdleInstances: 2,
+				MaxIdleInstances: 3,
+			},
+		},
+		{
+			raw: map[string]interface{}{
+				"scaling": []interface{}{
+					map[string]interface{}{
+						"minIdleInstances":  2,
+						"maxPendingLatency": "1s",
+					},
+				},
+			},
+			expected: &appengine.AutomaticScaling{
+				MinIdleInstances:  2,
+				MaxIdleInstances:  3,
+				MaxPendingLatency: "1s",
+			},
+		},
+		{
+			raw: map[string]interface{}{
+				"scaling": []interface{}{
+					map[string]interface{}{
+						"min_idle_instances":  0,
+						"max_idle_instances":  5,
+						"min_pending_latency": "250ms",
+						"max_pending_latency": "10s",
+					},
+				},
+			},
+			expected: &appengine.AutomaticScaling{
+				MinIdleInstances:  0,
+				MaxIdleInstances:  5,
+				MinPendingLatency: "0.25s",
+				MaxPendingLatency: "10s",
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		d := schema.TestResourceDataRaw(t, resourceAppengine().Schema, tc.raw)
+		actual := expandAutomaticScaling(d.Get("scaling").([]interface{}))
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("case %d: expected %#v, got %#v", i, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"google.golang.org/api/appengine/v1"
+)
+
+func resourceAppengineVersionRetention() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceAppengineVersionRetentionCreate,
+		Read:   resourceAppengineVersionRetentionRead,
+		Update: resourceAppengineVersionRetentionUpdate,
+		Delete: resourceAppengineVersionRetentionDelete,
+
+		CustomizeDiff: resourceAppengineVersionRetentionCustomizeDiff,
+
+		Schema: map[string]*schema.Schema{
+			"project": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+			},
+
+			"module_name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			// how many of the most recent versions without traffic to keep
+			"keep": &schema.Schema{
+				Type:         schema.TypeInt,
+				Required:     true,
+				ValidateFunc: validateKeep,
+			},
+
+			"dry_run": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			// versions that fall outside the retention policy as of the
+			// last refresh, and will be deleted on the next apply
+			"pending_deletions": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"deleted_versions": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+		},
+	}
+}
+
+func validateKeep(v interface{}, k string) (ws []string, errors []error) {
+	if v.(int) < 0 {
+		errors = append(errors, fmt.Errorf("%q must not be negative", k))
+	}
+	return
+}
+
+// nothing has been planned for deletion when the policy is created, so the
+// first versions are only deleted by the apply after the one that creates it
+func resourceAppengineVersionRetentionCreate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	project := getProject(d, config)
+	d.Set("project", project)
+
+	d.SetId("apps/" + project + "/services/" + d.Get("module_name").(string) + "/retention")
+	d.Set("deleted_versions", []string{})
+
+	return resourceAppengineVersionRetentionRead(d, meta)
+}
+
+func resourceAppengineVersionRetentionRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+	project := getProject(d, config)
+
+	expired, err := expiredVersions(config, project, d.Get("module_name").(string), d.Get("keep").(int))
+	if err != nil {
+		return err
+	}
+
+	d.Set("project", project)
+	d.Set("pending_deletions", expired)
+	return nil
+}
+
+func resourceAppengineVersionRetentionUpdate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(*Config)
+
+	err := applyVersionRetention(d, config)
+	if err != nil {
+		return err
+	}
+
+	return resourceAppengineVersionRetentionRead(d, meta)
+}
+
+// deleting the policy leaves the module's versions alone
+func resourceAppengineVersionRetentionDelete(d *schema.ResourceData, meta interface{}) error {
+	d.SetId("")
+	return nil
+}
+
+// resourceAppengineVersionRetentionCustomizeDiff plans an update whenever the
+// last refresh found versions to delete, so the policy is enforced on every
+// apply rather than only when its arguments change
+func resourceAppengineVersionRetentionCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || d.Get("dry_run").(bool) {
+		return nil
+	}
+
+	if len(d.Get("pending_deletions").([]interface{})) > 0 {
+		return d.SetNewComputed("deleted_versions")
+	}
+
+	return nil
+}
+
+func applyVersionRetention(d *schema.ResourceData, config *Config) error {
+	project := getProject(d, config)
+	moduleName := d.Get("module_name").(string)
+
+	fresh, err := expiredVersions(config, project, moduleName, d.Get("keep").(int))
+	if err != nil {
+		return err
+	}
+	expired := plannedDeletions(d.Get("pending_deletions").([]interface{}), fresh)
+
+	if d.Get("dry_run").(bool) {
+		for _, versionId := range expired {
+			log.Printf("[INFO] Dry run: would delete version %s of module %s", versionId, moduleName)
+		}
+		d.Set("deleted_versions", []string{})
+		return nil
+	}
+
+	moduleVersionService := appengine.NewAppsServicesVersionsService(config.clientAppengine)
+	deleted := make([]string, 0, len(expired))
+	for _, versionId := range expired {
+		log.Printf("[INFO] Deleting version %s of module %s", versionId, moduleName)
+		operation, err := moduleVersionService.Delete(project, moduleName, versionId).Do()
+		if err == nil {
+			err = operationWait(operation, project, config)
+		}
+		if err != nil {
+			d.Set("deleted_versions", deleted)
+			return fmt.Errorf("Error deleting version %s of module %s: %s", versionId, moduleName, err)
+		}
+		deleted = append(deleted, versionId)
+	}
+
+	d.Set("deleted_versions", deleted)
+	return nil
+}
+
+// plannedDeletions narrows the versions expired now down to those the plan
+// showed as pending_deletions, so a version that only fell outside the policy
+// between plan and apply is never deleted without the operator seeing it
+func plannedDeletions(planned []interface{}, expired []string) []string {
+	shown := make(map[string]bool, len(planned))
+	for _, versionId := range planned {
+		shown[versionId.(string)] = true
+	}
+
+	deletions := make([]string, 0, len(expired))
+	for _, versionId := range expired {
+		if shown[versionId] {
+			deletions = append(deletions, versionId)
+		} else {
+			log.Printf("[INFO] Version %s expired since the last refresh, leaving it for the next apply", versionId)
+		}
+	}
+	return deletions
+}
+
+// expiredVersions lists the module's versions and picks out the ones the
+// policy would delete
+func expiredVersions(config *Config, project, moduleName string, keep int) ([]string, error) {
+	moduleService := appengine.NewAppsServicesService(config.clientAppengine)
+	module, err := moduleService.Get(project, moduleName).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := listVersions(config, project, moduleName)
+	if err != nil {
+		return nil, err
+	}
+
+	allocations := make(map[string]float64)
+	if module.Split != nil {
+		allocations = module.Split.Allocations
+	}
+
+	return selectExpiredVersions(versions, allocations, keep), nil
+}
+
+type versionsByCreation []*appengine.Version
+
+func (v versionsByCreation) Len() int      { return len(v) }
+func (v versionsByCreation) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v versionsByCreation) Less(i, j int) bool {
+	ti, _ := time.Parse(time.RFC3339Nano, v[i].CreateTime)
+	tj, _ := time.Parse(time.RFC3339Nano, v[j].CreateTime)
+	return ti.After(tj)
+}
+
+// selectExpiredVersions returns every version beyond the keep most recent
+// ones that receive no traffic.  Versions with any share of the traffic split
+// are never returned.
+func selectExpiredVersions(versions []*appengine.Version, allocations map[string]float64, keep int) []string {
+	idle := make([]*appengine.Version, 0, len(versions))
+	for _, version := range versions {
+		if allocations[version.Id] > 0 {
+			continue
+		}
+		idle = append(idle, version)
+	}
+	sort.Stable(versionsByCreation(idle))
+
+	expired := make([]string, 0)
+	for i, version := range idle {
+		if i >= keep {
+			expired = append(expired, version.Id)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/appengine/v1"
+)
+
+func TestSelectExpiredVersions(t *testing.T) {
+	versions := []*appengine.Version{
+		&appengine.Version{Id: "v1", CreateTime: "2016-03-01T10:00:00.000Z"},
+		&appengine.Version{Id: "v2", CreateTime: "2016-03-02T10:00:00.000Z"},
+		&appengine.Version{Id: "v3", CreateTime: "2016-03-03T10:00:00.000Z"},
+		&appengine.Version{Id: "v4", CreateTime: "2016-03-04T10:00:00.000Z"},
+		&appengine.Version{Id: "v5", CreateTime: "2016-03-05T10:00:00.000Z"},
+	}
+
+	cases := []struct {
+		allocations map[string]float64
+		keep        int
+		expected    []string
+	}{
+		{map[string]float64{"v5": 1}, 2, []string{"v2", "v1"}},
+		{map[string]float64{"v5": 1}, 10, []string{}},
+		{map[string]float64{"v1": 0.5, "v5": 0.5}, 1, []string{"v3", "v2"}},
+		{map[string]float64{}, 0, []string{"v5", "v4", "v3", "v2", "v1"}},
+	}
+
+	for i, tc := range cases {
+		actual := selectExpiredVersions(versions, tc.allocations, tc.keep)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("case %d: expected %v, got %v", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestPlannedDeletions(t *testing.T) {
+	cases := []struct {
+		planned  []interface{}
+		expired  []string
+		expected []string
+	}{
+		{[]interface{}{"v2", "v1"}, []string{"v2", "v1"}, []string{"v2", "v1"}},
+		// v3 lost its traffic after the plan was made
+		{[]interface{}{"v2", "v1"}, []string{"v3", "v2", "v1"}, []string{"v2", "v1"}},
+		// v1 was given traffic after the plan was made
+		{[]interface{}{"v2", "v1"}, []string{"v2"}, []string{"v2"}},
+		{[]interface{}{}, []string{"v2", "v1"}, []string{}},
+	}
+
+	for i, tc := range cases {
+		actual := plannedDeletions(tc.planned, tc.expired)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("case %d: expected %v, got %v", i, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"google.golang.org/api/appengine/v1"
+)
+
+// rolloutVersion shifts the module's traffic onto this version one step at a
+// time, probing the configured health URL between steps.  If a step fails its
+// health check the split is put back the way it was before the rollout began.
+func rolloutVersion(d *schema.ResourceData, config *Config) error {
+	rollout := d.Get("rollout").([]interface{})[0].(map[string]interface{})
+	project := getProject(d, config)
+	moduleName := d.Get("module_name").(string)
+	versionId := d.Get("version").(string)
+
+	moduleService := appengine.NewAppsServicesService(config.clientAppengine)
+	module, err := moduleService.Get(project, moduleName).Do()
+	if err != nil {
+		return err
+	}
+
+	// the split is restored exactly as it was on failure, including any
+	// share this version already had; the steps only scale the others and
+	// keep the module sharded the way it was
+	original := module.Split
+	previous := make(map[string]float64)
+	shardBy := ""
+	if original != nil {
+		for id, share := range original.Allocations {
+			if id != versionId {
+				previous[id] = share
+			}
+		}
+		shardBy = original.ShardBy
+	}
+
+	interval, err := time.ParseDuration(rollout["step_interval"].(string))
+	if err != nil {
+		return err
+	}
+	healthURL := rollout["health_url"].(string)
+	checks := rollout["health_checks"].(int)
+	maxErrorRate := rollout["max_error_rate"].(float64)
+
+	steps := rollout["steps"].([]interface{})
+	for i, raw := range steps {
+		percent := raw.(float64)
+		log.Printf("[INFO] Rollout of %s step %d/%d: %g%% of traffic", versionId, i+1, len(steps), percent)
+
+		err = patchTrafficSplit(config, project, moduleName, &appengine.TrafficSplit{
+			Allocations: splitAllocations(previous, versionId, percent/100),
+			ShardBy:     shardBy,
+		})
+		if err == nil {
+			err = checkRolloutHealth(healthURL, checks, interval, maxErrorRate)
+		}
+		if err != nil {
+			if original == nil || len(original.Allocations) == 0 {
+				return fmt.Errorf("rollout of %s failed at step %d (%g%%) and module %s had no previous split to roll back to: %s",
+					versionId, i+1, percent, moduleName, err)
+			}
+			log.Printf("[WARN] Rolling back traffic split for module %s", moduleName)
+			if rollbackErr := patchTrafficSplit(config, project, moduleName, original); rollbackErr != nil {
+				return fmt.Errorf("rollout of %s failed at step %d (%g%%): %s; rolling back the split also failed: %s",
+					versionId, i+1, percent, err, rollbackErr)
+			}
+			return fmt.Errorf("rollout of %s failed at step %d (%g%%) and was rolled back: %s", versionId, i+1, percent, err)
+		}
+
+		d.Set("rollout_step", i+1)
+	}
+
+	return nil
+}
+
+// splitAllocations gives share of the traffic to versionId and scales the
+// previous allocations down to fill the remainder.  App Engine only accepts
+// allocations to two decimal places which add up to exactly 1, so any rounding
+// error is absorbed by the largest of the previous versions.
+func splitAllocations(previous map[string]float64, versionId string, share float64) map[string]float64 {
+	share = roundAllocation(share)
+	if len(previous) == 0 || share >= 1 {
+		return map[string]float64{versionId: 1}
+	}
+
+	total := 0.0
+	for _, s := range previous {
+		total += s
+	}
+
+	allocations := map[string]float64{versionId: share}
+	remaining := 1 - share
+	assigned := share
+	largest := ""
+	for id, s := range previous {
+		scaled := roundAllocation(s / total * remaining)
+		if scaled <= 0 {
+			continue
+		}
+		allocations[id] = scaled
+		assigned += scaled
+		if largest == "" || scaled > allocations[largest] {
+			largest = id
+		}
+	}
+
+	if largest != "" {
+		allocations[largest] = roundAllocation(allocations[largest] + 1 - assigned)
+	} else {
+		allocations[versionId] = 1
+	}
+
+	return allocations
+}
+
+func roundAllocation(share float64) float64 {
+	return math.Floor(share*100+0.5) / 100
+}
+
+// checkRolloutHealth spreads checks requests to healthURL over interval and
+// fails if more than maxErrorRate of them come back with anything other than a
+// 2xx
+func checkRolloutHealth(healthURL string, checks int, interval time.Duration, maxErrorRate float64) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	failures := 0
+	for i := 0; i < checks; i++ {
+		time.Sleep(interval / time.Duration(checks))
+
+		resp, err := client.Get(healthURL)
+		if err != nil {
+			log.Printf("[DEBUG] health check against %s failed: %s", healthURL, err)
+			failures++
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			log.Printf("[DEBUG] health check against %s returned %d", healthURL, resp.StatusCode)
+			failures++
+		}
+	}
+
+	errorRate := float64(failures) / float64(checks)
+	if errorRate > maxErrorRate {
+		return fmt.Errorf("%d of %d health checks against %s failed (error rate %.2f, allowed %.2f)",
+			failures, checks, healthURL, errorRate, maxErrorRate)
+	}
+
+	return nil
+}
+
+// validateRolloutSteps checks the steps only ever move traffic onto the
+// version and finish with all of it
+func validateRolloutSteps(steps []interface{}) error {
+	last := 0.0
+	for _, raw := range steps {
+		percent := raw.(float64)
+		if percent <= last {
+			return fmt.Errorf("rollout steps must be strictly increasing, got %g after %g", percent, last)
+		}
+		last = percent
+	}
+	if last != 100 {
+		return fmt.Errorf("rollout steps must end at 100 so the version gets all of the traffic, got %g", last)
+	}
+	return nil
+}
+
+// validateRolloutStep checks a step is a percentage that still sends some
+// traffic once rounded to the whole percents App Engine allocates in
+func validateRolloutStep(v interface{}, k string) (ws []string, errors []error) {
+	percent := v.(float64)
+	if percent <= 0 || percent > 100 {
+		errors = append(errors, fmt.Errorf("%q must be a percentage between 0 and 100, got %g", k, percent))
+	} else if roundAllocation(percent/100) == 0 {
+		errors = append(errors, fmt.Errorf(
+			"%q of %g%% rounds to no traffic, App Engine splits traffic in whole percents", k, percent))
+	}
+	return
+}
+
+func validateHealthChecks(v interface{}, k string) (ws []string, errors []error) {
+	if v.(int) < 1 {
+		errors = append(errors, fmt.Errorf("%q must be at least 1", k))
+	}
+	return
+}
+
+func validateStepInterval(v interface{}, k string) (ws []string, errors []error) {
+	if _, err := time.ParseDuration(v.(string)); err != nil {
+		errors = append(errors, fmt.Errorf("%q must be a duration such as 30s or 5m: %s", k, err))
+	}
+	return
+}
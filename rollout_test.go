@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"google.golang.org/api/appengine/v1"
+)
+
+func TestSplitAllocations(t *testing.T) {
+	cases := []struct {
+		previous map[string]float64
+		share    float64
+		expected map[string]float64
+	}{
+		{
+			previous: map[string]float64{},
+			share:    0.1,
+			expected: map[string]float64{"v2": 1},
+		},
+		{
+			previous: map[string]float64{"v1": 1},
+			share:    0.01,
+			expected: map[string]float64{"v1": 0.99, "v2": 0.01},
+		},
+		{
+			previous: map[string]float64{"v1": 1},
+			share:    0.5,
+			expected: map[string]float64{"v1": 0.5, "v2": 0.5},
+		},
+		{
+			previous: map[string]float64{"v1": 1},
+			share:    1,
+			expected: map[string]float64{"v2": 1},
+		},
+		{
+			previous: map[string]float64{"v0": 0.25, "v1": 0.75},
+			share:    0.2,
+			expected: map[string]float64{"v0": 0.2, "v1": 0.6, "v2": 0.2},
+		},
+	}
+
+	for i, tc := range cases {
+		actual := splitAllocations(tc.previous, "v2", tc.share)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("case %d: expected %v, got %v", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestSplitAllocations_rounding(t *testing.T) {
+	actual := splitAllocations(map[string]float64{"a": 0.5, "b": 0.5}, "v2", 0.01)
+
+	total := 0.0
+	for _, s := range actual {
+		total += s
+	}
+	if roundAllocation(total) != 1 {
+		t.Fatalf("allocations %v do not add up to 1", actual)
+	}
+	if actual["v2"] != 0.01 {
+		t.Fatalf("expected v2 to get 0.01, got %v", actual)
+	}
+}
+
+func TestValidateRolloutStep(t *testing.T) {
+	cases := map[float64]bool{
+		1:     false,
+		0.5:   false,
+		12.5:  false,
+		100:   false,
+		0:     true,
+		0.4:   true,
+		-10:   true,
+		100.5: true,
+	}
+
+	for value, expectErr := range cases {
+		_, errors := validateRolloutStep(value, "steps")
+		if (len(errors) > 0) != expectErr {
+			t.Fatalf("%g: expected error %t, got %v", value, expectErr, errors)
+		}
+	}
+}
+
+func TestCheckRolloutHealth(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/healthy":
+		case "/flaky":
+			// every other check fails
+			if n%2 == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		path         string
+		maxErrorRate float64
+		expectErr    bool
+	}{
+		{"/healthy", 0, false},
+		{"/flaky", 0.5, false},
+		{"/flaky", 0.25, true},
+		{"/broken", 0.5, true},
+	}
+
+	for _, tc := range cases {
+		mu.Lock()
+		requests = 0
+		mu.Unlock()
+
+		err := checkRolloutHealth(server.URL+tc.path, 4, 4*time.Millisecond, tc.maxErrorRate)
+		if (err != nil) != tc.expectErr {
+			t.Fatalf("%s with max error rate %g: expected error %t, got %v", tc.path, tc.maxErrorRate, tc.expectErr, err)
+		}
+
+		mu.Lock()
+		if requests != 4 {
+			t.Fatalf("%s: expected 4 health checks, got %d", tc.path, requests)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestValidateRolloutSteps(t *testing.T) {
+	cases := []struct {
+		steps     []interface{}
+		expectErr bool
+	}{
+		{[]interface{}{100.0}, false},
+		{[]interface{}{1.0, 10.0, 50.0, 100.0}, false},
+		{[]interface{}{}, true},
+		{[]interface{}{1.0, 10.0}, true},
+		{[]interface{}{50.0, 10.0, 100.0}, true},
+		{[]interface{}{50.0, 50.0, 100.0}, true},
+	}
+
+	for _, tc := range cases {
+		err := validateRolloutSteps(tc.steps)
+		if (err != nil) != tc.expectErr {
+			t.Fatalf("%v: expected error %t, got %v", tc.steps, tc.expectErr, err)
+		}
+	}
+}
+
+// a failed health check puts back the split as it was before the rollout,
+// including the share the version being rolled out already had, and leaves
+// promote to be retried by the next apply
+func TestRolloutVersion_rollback(t *testing.T) {
+	var mu sync.Mutex
+	patches := make([]*appengine.TrafficSplit, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/health":
+			w.WriteHeader(http.StatusInternalServerError)
+
+		case r.URL.Path == "/v1/apps/my-project/services/foobar" && r.Method == "GET":
+			json.NewEncoder(w).Encode(&appengine.Service{
+				Name: "apps/my-project/services/foobar",
+				Id:   "foobar",
+				Split: &appengine.TrafficSplit{
+					Allocations: map[string]float64{"v1": 0.7, "v2": 0.3},
+					ShardBy:     "COOKIE",
+				},
+			})
+
+		case r.URL.Path == "/v1/apps/my-project/services/foobar" && r.Method == "PATCH":
+			var module appengine.Service
+			if err := json.NewDecoder(r.Body).Decode(&module); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			patches = append(patches, module.Split)
+			mu.Unlock()
+			json.NewEncoder(w).Encode(&appengine.Operation{
+				Name: "apps/my-project/operations/split",
+				Done: true,
+			})
+
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := &Config{
+		AccessToken:       "fake-token",
+		Project:           "my-project",
+		AppengineEndpoint: server.URL,
+		StorageEndpoint:   server.URL,
+	}
+	if err := config.loadAndValidate(); err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceAppengine().Schema, map[string]interface{}{
+		"module_name": "foobar",
+		"version":     "v2",
+		"promote":     true,
+		"rollout": []interface{}{
+			map[string]interface{}{
+				"steps":         []interface{}{50.0, 100.0},
+				"health_url":    server.URL + "/health",
+				"health_checks": 2,
+				"step_interval": "2ms",
+			},
+		},
+	})
+
+	err := applyServingUpdates(d, config, []string{"promote"})
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("expected the rollout to fail and be rolled back, got %v", err)
+	}
+	if d.Get("promote").(bool) {
+		t.Fatalf("expected promote to be reset after the rollback")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(patches) != 2 {
+		t.Fatalf("expected the first step and a rollback, got %d patches", len(patches))
+	}
+
+	step := map[string]float64{"v1": 0.5, "v2": 0.5}
+	if !reflect.DeepEqual(patches[0].Allocations, step) || patches[0].ShardBy != "COOKIE" {
+		t.Fatalf("expected the first step to split %v sharded by COOKIE, got %#v", step, patches[0])
+	}
+
+	original := map[string]float64{"v1": 0.7, "v2": 0.3}
+	if !reflect.DeepEqual(patches[1].Allocations, original) || patches[1].ShardBy != "COOKIE" {
+		t.Fatalf("expected the rollback to restore %v sharded by COOKIE, got %#v", original, patches[1])
+	}
+}
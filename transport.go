@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/time/rate"
+)
+
+// isDebugLogging reports whether Terraform was started with TF_LOG at DEBUG
+// or TRACE, the levels at which API traffic is worth the noise
+func isDebugLogging() bool {
+	level := strings.ToUpper(os.Getenv("TF_LOG"))
+	return level == "DEBUG" || level == "TRACE"
+}
+
+// loggingTransport writes every request and response to the debug log with
+// credential headers redacted
+type loggingTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		log.Printf("[DEBUG] Google API Request:\n%s", redactHeaders(string(dump)))
+	} else {
+		log.Printf("[DEBUG] Could not dump Google API request: %s", err)
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		log.Printf("[DEBUG] Google API Request failed: %s", err)
+		return resp, err
+	}
+
+	if dump, err := httputil.DumpResponse(resp, true); err == nil {
+		log.Printf("[DEBUG] Google API Response:\n%s", redactHeaders(string(dump)))
+	} else {
+		log.Printf("[DEBUG] Could not dump Google API response: %s", err)
+	}
+
+	return resp, nil
+}
+
+// headerTransport sets fixed headers on every request, leaving the caller's
+// request untouched as http.RoundTripper requires
+type headerTransport struct {
+	transport http.RoundTripper
+	headers   map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	clone := new(http.Request)
+	*clone = *req
+	clone.Header = make(http.Header, len(req.Header)+len(t.headers))
+	for k, v := range req.Header {
+		clone.Header[k] = append([]string(nil), v...)
+	}
+	for k, v := range t.headers {
+		clone.Header.Set(k, v)
+	}
+	return t.transport.RoundTrip(clone)
+}
+
+// rateLimitTransport holds every request until the limiter shared by all the
+// provider's API calls lets it through
+type rateLimitTransport struct {
+	transport http.RoundTripper
+	limiter   *rate.Limiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.transport.RoundTrip(req)
+}
+
+var credentialHeaderRegexp = regexp.MustCompile(`(?im)^((?:Proxy-)?Authorization|X-Goog-Iam-Authorization-Token):.*$`)
+
+func redactHeaders(dump string) string {
+	return credentialHeaderRegexp.ReplaceAllString(dump, "$1: <redacted>")
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	dump := "GET /v1/apps/my-project HTTP/1.1\r\n" +
+		"Host: appengine.googleapis.com\r\n" +
+		"Authorization: Bearer ya29.secret\r\n" +
+		"authorization: Bearer ya29.lowercase\r\n" +
+		"Proxy-Authorization: Basic c2VjcmV0\r\n" +
+		"X-Goog-Iam-Authorization-Token: secret-token\r\n" +
+		"User-Agent: Terraform/0.12.0\r\n\r\n"
+
+	redacted := redactHeaders(dump)
+	for _, secret := range []string{"ya29.secret", "ya29.lowercase", "c2VjcmV0", "secret-token"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("expected %q to be redacted from:\n%s", secret, redacted)
+		}
+	}
+	for _, kept := range []string{"Host: appengine.googleapis.com", "User-Agent: Terraform/0.12.0", "Authorization: <redacted>"} {
+		if !strings.Contains(redacted, kept) {
+			t.Errorf("expected %q to be kept in:\n%s", kept, redacted)
+		}
+	}
+}
+
+func TestLoggingTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "my-project"}`))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	client := &http.Client{Transport: &loggingTransport{transport: http.DefaultTransport}}
+	req, err := http.NewRequest("GET", server.URL+"/v1/apps/my-project", nil)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer ya29.secret")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	resp.Body.Close()
+
+	out := buf.String()
+	if strings.Contains(out, "ya29.secret") {
+		t.Errorf("access token leaked into the log:\n%s", out)
+	}
+	if !strings.Contains(out, "/v1/apps/my-project") || !strings.Contains(out, `"id": "my-project"`) {
+		t.Errorf("expected request and response in the log:\n%s", out)
+	}
+}
+
+func TestIsDebugLogging(t *testing.T) {
+	defer os.Setenv("TF_LOG", os.Getenv("TF_LOG"))
+
+	cases := map[string]bool{
+		"":      false,
+		"INFO":  false,
+		"WARN":  false,
+		"DEBUG": true,
+		"debug": true,
+		"TRACE": true,
+	}
+	for level, expected := range cases {
+		os.Setenv("TF_LOG", level)
+		if got := isDebugLogging(); got != expected {
+			t.Errorf("TF_LOG=%q: expected %t, got %t", level, expected, got)
+		}
+	}
+}
+
+func TestHeaderTransport(t *testing.T) {
+	var mu sync.Mutex
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = r.Header.Get("X-Goog-User-Project")
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &headerTransport{
+		transport: http.DefaultTransport,
+		headers:   map[string]string{"X-Goog-User-Project": "billing-project"},
+	}}
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	resp.Body.Close()
+
+	mu.Lock()
+	if got != "billing-project" {
+		t.Errorf("expected X-Goog-User-Project to be billing-project, got %q", got)
+	}
+	mu.Unlock()
+	if req.Header.Get("X-Goog-User-Project") != "" {
+		t.Errorf("expected the caller's request to be left unmodified")
+	}
+}
+
+// the debug log shows the quota project header as it is sent
+func TestConfigNewTransport_logsUserProject(t *testing.T) {
+	defer os.Setenv("TF_LOG", os.Getenv("TF_LOG"))
+	os.Setenv("TF_LOG", "DEBUG")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	config := &Config{
+		Project:             "my-project",
+		BillingProject:      "billing-project",
+		UserProjectOverride: true,
+	}
+	client := &http.Client{Transport: config.newTransport()}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	resp.Body.Close()
+
+	if !strings.Contains(buf.String(), "X-Goog-User-Project: billing-project") {
+		t.Errorf("expected the logged request to carry X-Goog-User-Project:\n%s", buf.String())
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	// a burst of one and no refill to speak of: the second call must wait
+	client := &http.Client{Transport: &rateLimitTransport{
+		transport: http.DefaultTransport,
+		limiter:   rate.NewLimiter(rate.Every(time.Hour), 1),
+	}}
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.Do(req.WithContext(ctx)); err == nil {
+		t.Fatalf("expected the second request to be held back by the limiter")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 1 {
+		t.Errorf("expected 1 request to reach the server, got %d", requests)
+	}
+}